@@ -24,24 +24,15 @@ resource "vers_vm" "golden_base" {
 resource "vers_provision" "golden_setup" {
   vm_id = vers_vm.golden_base.id
 
-  files = [
-    {
-      source      = "${path.module}/scripts/bootstrap.sh"
-      destination = "/tmp/bootstrap.sh"
-    },
+  scripts = [
+    { source = "${path.module}/scripts/bootstrap.sh" },
   ]
 
   commands = [
-    "chmod +x /tmp/bootstrap.sh",
-    "bash /tmp/bootstrap.sh",
     "mkdir -p /root/.swarm/status",
     "echo '{\"vms\":[]}' > /root/.swarm/registry.json",
     "touch /root/.swarm/registry.lock",
   ]
-
-  triggers = {
-    bootstrap = filesha256("${path.module}/scripts/bootstrap.sh")
-  }
 }
 
 # --- Commit as golden image ---
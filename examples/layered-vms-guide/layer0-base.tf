@@ -15,25 +15,12 @@ resource "vers_vm" "layer0" {
 resource "vers_provision" "layer0" {
   vm_id = vers_vm.layer0.id
 
-  # Upload your bootstrap script to the VM
-  files = [
-    {
-      source      = "${path.module}/scripts/base.sh"
-      destination = "/tmp/base.sh"
-    },
-  ]
-
-  # Run it
-  commands = [
-    "chmod +x /tmp/base.sh",
-    "bash /tmp/base.sh",
-  ]
-
+  # Upload your bootstrap script to the VM and run it.
   # When the script changes, this layer re-provisions.
   # That cascades: layers 1, 2, 3 all rebuild too.
-  triggers = {
-    script = filesha256("${path.module}/scripts/base.sh")
-  }
+  scripts = [
+    { source = "${path.module}/scripts/base.sh" },
+  ]
 }
 
 resource "vers_vm_commit" "layer0" {
@@ -13,11 +13,7 @@ resource "vers_provision" "layer1" {
   vm_id = vers_vm_restore.layer1.id
 
   files = [
-    {
-      source      = "${path.module}/scripts/tools.sh"
-      destination = "/tmp/tools.sh"
-    },
-    # You can also inline content directly — useful for config files
+    # Inline content is useful for config files
     # that depend on Terraform variables:
     {
       content     = <<-EOF
@@ -28,13 +24,11 @@ resource "vers_provision" "layer1" {
     },
   ]
 
-  commands = [
-    "chmod +x /tmp/tools.sh",
-    "bash /tmp/tools.sh",
+  scripts = [
+    { source = "${path.module}/scripts/tools.sh" },
   ]
 
   triggers = {
-    script    = filesha256("${path.module}/scripts/tools.sh")
     infra_url = var.infra_url
   }
 }
@@ -11,20 +11,17 @@ resource "vers_vm_restore" "layer2" {
 resource "vers_provision" "layer2" {
   vm_id = vers_vm_restore.layer2.id
 
-  files = [
+  scripts = [
     {
-      source      = "${path.module}/scripts/app.sh"
-      destination = "/tmp/app.sh"
+      source = "${path.module}/scripts/app.sh"
+      env = {
+        APP_REPO   = var.app_repo
+        APP_BRANCH = var.app_branch
+      }
     },
   ]
 
-  commands = [
-    "chmod +x /tmp/app.sh",
-    "APP_REPO='${var.app_repo}' APP_BRANCH='${var.app_branch}' bash /tmp/app.sh",
-  ]
-
   triggers = {
-    script = filesha256("${path.module}/scripts/app.sh")
     repo   = var.app_repo
     branch = var.app_branch
   }
@@ -36,21 +36,9 @@ resource "vers_vm" "layer0_base" {
 resource "vers_provision" "layer0_setup" {
   vm_id = vers_vm.layer0_base.id
 
-  files = [
-    {
-      source      = "${path.module}/scripts/layer0-base.sh"
-      destination = "/tmp/layer0-base.sh"
-    },
-  ]
-
-  commands = [
-    "chmod +x /tmp/layer0-base.sh",
-    "bash /tmp/layer0-base.sh",
+  scripts = [
+    { source = "${path.module}/scripts/layer0-base.sh" },
   ]
-
-  triggers = {
-    script = filesha256("${path.module}/scripts/layer0-base.sh")
-  }
 }
 
 resource "vers_vm_commit" "layer0" {
@@ -75,36 +63,27 @@ resource "vers_vm_restore" "layer1_vm" {
 resource "vers_provision" "layer1_setup" {
   vm_id = vers_vm_restore.layer1_vm.id
 
+  scripts = [
+    { source = "${path.module}/scripts/layer1-devtools.sh" },
+  ]
+
   files = [
-    {
-      source      = "${path.module}/scripts/layer1-devtools.sh"
-      destination = "/tmp/layer1-devtools.sh"
-    },
-    # Add your extensions here:
-    # {
-    #   source      = "${path.module}/extensions/vers-vm.ts"
-    #   destination = "/root/.pi/agent/extensions/vers-vm.ts"
-    # },
+    # Upload your extensions directory in one go:
     # {
-    #   source      = "${path.module}/extensions/vers-swarm.ts"
-    #   destination = "/root/.pi/agent/extensions/vers-swarm.ts"
+    #   source_dir  = "${path.module}/extensions"
+    #   destination = "/root/.pi/agent/extensions"
+    #   include     = ["**/*.ts"]
+    #   exclude     = ["node_modules"]
     # },
   ]
 
-  commands = concat(
-    [
-      "chmod +x /tmp/layer1-devtools.sh",
-      "bash /tmp/layer1-devtools.sh",
-    ],
-    # Bake infra connection into /etc/environment if URL provided
-    var.infra_url != "" ? [
-      "echo 'VERS_INFRA_URL=${var.infra_url}' >> /etc/environment",
-      "echo 'VERS_AUTH_TOKEN=${var.auth_token}' >> /etc/environment",
-    ] : [],
-  )
+  # Bake infra connection into /etc/environment if URL provided
+  commands = var.infra_url != "" ? [
+    "echo 'VERS_INFRA_URL=${var.infra_url}' >> /etc/environment",
+    "echo 'VERS_AUTH_TOKEN=${var.auth_token}' >> /etc/environment",
+  ] : []
 
   triggers = {
-    script    = filesha256("${path.module}/scripts/layer1-devtools.sh")
     infra_url = var.infra_url
   }
 }
@@ -131,20 +110,17 @@ resource "vers_vm_restore" "layer2_vm" {
 resource "vers_provision" "layer2_setup" {
   vm_id = vers_vm_restore.layer2_vm.id
 
-  files = [
+  scripts = [
     {
-      source      = "${path.module}/scripts/layer2-app.sh"
-      destination = "/tmp/layer2-app.sh"
+      source = "${path.module}/scripts/layer2-app.sh"
+      env = {
+        APP_REPO   = var.app_repo
+        APP_BRANCH = var.app_branch
+      }
     },
   ]
 
-  commands = [
-    "chmod +x /tmp/layer2-app.sh",
-    "APP_REPO='${var.app_repo}' APP_BRANCH='${var.app_branch}' bash /tmp/layer2-app.sh",
-  ]
-
   triggers = {
-    script = filesha256("${path.module}/scripts/layer2-app.sh")
     repo   = var.app_repo
     branch = var.app_branch
   }
@@ -0,0 +1,190 @@
+package client
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// Archive formats accepted by UploadArchive.
+const (
+	ArchiveDir   = "dir"
+	ArchiveTar   = "tar"
+	ArchiveTarGz = "tar.gz"
+	ArchiveZip   = "zip"
+)
+
+// ArchiveOptions controls how UploadArchive extracts an archive.
+type ArchiveOptions struct {
+	// StripComponents drops this many leading path segments from every
+	// entry, like tar --strip-components.
+	StripComponents int
+	// Clean replaces the destination directory instead of extracting on
+	// top of it. The archive is extracted next to it first and swapped in
+	// with a rename, so a failed extraction leaves the old directory intact.
+	Clean bool
+}
+
+// ArchiveFormat detects the format of a local archive from its extension,
+// or ArchiveDir for a directory, whose tarball is generated on the fly.
+func ArchiveFormat(localPath string) (string, error) {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return ArchiveDir, nil
+	}
+	name := strings.ToLower(localPath)
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return ArchiveTarGz, nil
+	case strings.HasSuffix(name, ".tar"):
+		return ArchiveTar, nil
+	case strings.HasSuffix(name, ".zip"):
+		return ArchiveZip, nil
+	}
+	return "", fmt.Errorf("%s: unsupported archive format (expected .tar, .tar.gz, .tgz, .zip or a directory)", localPath)
+}
+
+// UploadArchive streams a local archive to the VM and extracts it into
+// remoteDir. Tarballs are sent as they are, a directory is packed on the fly
+// and a zip file is converted to a tar stream locally, so the VM only needs
+// tar. Ownership in attrs is applied recursively to remoteDir afterwards;
+// file modes come from the archive.
+func (s *SSHClient) UploadArchive(ctx context.Context, localPath, remoteDir string, opts ArchiveOptions, attrs FileAttrs) error {
+	format, err := ArchiveFormat(localPath)
+	if err != nil {
+		return err
+	}
+	if opts.Clean && path.Clean("/"+remoteDir) == "/" {
+		return fmt.Errorf("refusing to clean %q", remoteDir)
+	}
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	srcErr := make(chan error, 1)
+	go func() {
+		err := writeArchive(pw, localPath, format)
+		pw.CloseWithError(err)
+		srcErr <- err
+	}()
+
+	_, execErr := s.ExecWithStdin(ctx, extractCommand(remoteDir, format, opts, attrs), pr)
+	pr.Close()
+	if err := <-srcErr; err != nil && !errors.Is(err, io.ErrClosedPipe) {
+		return fmt.Errorf("read archive %s: %w", localPath, err)
+	}
+	if execErr != nil {
+		return fmt.Errorf("extract to %s on VM: %w", remoteDir, execErr)
+	}
+	return nil
+}
+
+// extractCommand builds the remote command that reads a tar stream of the
+// given format from stdin and extracts it into remoteDir.
+func extractCommand(remoteDir, format string, opts ArchiveOptions, attrs FileAttrs) string {
+	tarFlags := "-xf -"
+	if format == ArchiveTarGz {
+		tarFlags = "-xzf -"
+	}
+	tarFlags += " --no-same-owner"
+	if opts.StripComponents > 0 {
+		tarFlags += fmt.Sprintf(" --strip-components=%d", opts.StripComponents)
+	}
+	chown := ""
+	if spec := attrs.chownSpec(); spec != "" {
+		chown = fmt.Sprintf(" && chown -R '%s' \"$d\"", ShellEscape(spec))
+	}
+
+	// A trailing slash would put the mktemp directory inside the
+	// destination, which the swap then deletes.
+	dest := ShellEscape(path.Clean(remoteDir))
+	if opts.Clean {
+		// Extract beside the destination, then swap it in.
+		return fmt.Sprintf("dest='%s'; mkdir -p \"$(dirname \"$dest\")\" && d=$(mktemp -d \"$dest.vers-tf-XXXXXX\") && "+
+			"{ { tar %s -C \"$d\" && chmod 755 \"$d\"%s && rm -rf \"$dest\" && mv \"$d\" \"$dest\"; } || { rm -rf \"$d\"; exit 1; }; }",
+			dest, tarFlags, chown)
+	}
+	return fmt.Sprintf("d='%s'; mkdir -p \"$d\" && tar %s -C \"$d\"%s", dest, tarFlags, chown)
+}
+
+// writeArchive writes the archive at localPath to w in a form tar can read.
+func writeArchive(w io.Writer, localPath, format string) error {
+	switch format {
+	case ArchiveDir:
+		files, err := ListTree(localPath, nil, nil)
+		if err != nil {
+			return err
+		}
+		return WriteTar(w, localPath, files, FileAttrs{})
+	case ArchiveZip:
+		return zipToTar(w, localPath)
+	default:
+		f, err := os.Open(localPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(w, f)
+		return err
+	}
+}
+
+// zipToTar re-encodes a zip file as a tar stream.
+func zipToTar(w io.Writer, localPath string) error {
+	zr, err := zip.OpenReader(localPath)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	tw := tar.NewWriter(w)
+	for _, zf := range zr.File {
+		info := zf.FileInfo()
+		link := ""
+		if info.Mode()&fs.ModeSymlink != 0 {
+			// Zip stores a symlink's target as its content.
+			rc, err := zf.Open()
+			if err != nil {
+				return err
+			}
+			target, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+			link = string(target)
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return fmt.Errorf("tar header for %s: %w", zf.Name, err)
+		}
+		hdr.Name = zf.Name
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		rc, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("read %s from %s: %w", zf.Name, localPath, err)
+		}
+	}
+	return tw.Close()
+}
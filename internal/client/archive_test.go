@@ -0,0 +1,67 @@
+package client
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtractCommand(t *testing.T) {
+	tests := []struct {
+		name      string
+		remoteDir string
+		opts      ArchiveOptions
+		want      string
+	}{
+		{"clean", "/opt/app", ArchiveOptions{Clean: true}, "dest='/opt/app';"},
+		{"clean with trailing slash", "/opt/app/", ArchiveOptions{Clean: true}, "dest='/opt/app';"},
+		{"merge with trailing slash", "/opt/app/", ArchiveOptions{}, "d='/opt/app';"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := extractCommand(tt.remoteDir, ArchiveTar, tt.opts, FileAttrs{})
+			if !strings.HasPrefix(cmd, tt.want) {
+				t.Errorf("command = %q, want prefix %q", cmd, tt.want)
+			}
+		})
+	}
+}
+
+// TestExtractCommandSwap runs the clean extraction locally against a
+// destination given with a trailing slash.
+func TestExtractCommandSwap(t *testing.T) {
+	if _, err := exec.LookPath("tar"); err != nil {
+		t.Skip("tar not available")
+	}
+	src, root := t.TempDir(), t.TempDir()
+	dest := filepath.Join(root, "app")
+	for p, content := range map[string]string{filepath.Join(src, "new.txt"): "new", filepath.Join(dest, "old.txt"): "old"} {
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stream bytes.Buffer
+	if err := WriteTar(&stream, src, []string{"new.txt"}, FileAttrs{}); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("sh", "-c", extractCommand(dest+"/", ArchiveTar, ArchiveOptions{Clean: true}, FileAttrs{}))
+	cmd.Stdin = &stream
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("extract: %v\n%s", err, out)
+	}
+
+	entries, err := os.ReadDir(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "new.txt" {
+		t.Errorf("destination holds %v, want only new.txt", entries)
+	}
+}
@@ -9,19 +9,32 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 )
 
-const DefaultBaseURL = "https://api.vers.sh/api/v1"
+const (
+	DefaultBaseURL  = "https://api.vers.sh/api/v1"
+	DefaultVMDomain = "vm.vers.sh"
+	DefaultSSHUser  = "root"
+)
 
 // Client is a Vers API client.
 type Client struct {
 	BaseURL    string
 	APIKey     string
 	HTTPClient *http.Client
+
+	// VMDomain is the DNS suffix under which VMs are reachable ({id}.{VMDomain}).
+	VMDomain string
+	// SSHUser is the login user for SSH connections to VMs.
+	SSHUser string
+	// SSHSudo runs every remote command through `sudo -n` when SSHUser is unprivileged.
+	SSHSudo bool
 }
 
-// New creates a new Vers API client.
+// New creates a new Vers API client. The VM domain is derived from the base URL.
 func New(apiKey, baseURL string) *Client {
 	if baseURL == "" {
 		baseURL = DefaultBaseURL
@@ -32,7 +45,26 @@ func New(apiKey, baseURL string) *Client {
 		HTTPClient: &http.Client{
 			Timeout: 5 * time.Minute, // some operations (create, commit) are slow
 		},
+		VMDomain: VMDomainFromBaseURL(baseURL),
+		SSHUser:  DefaultSSHUser,
+	}
+}
+
+// VMDomainFromBaseURL derives the VM host domain from an API base URL:
+// https://api.example.com/... maps to vm.example.com. Hosts without an
+// "api." prefix get "vm." prepended. Falls back to DefaultVMDomain when the
+// URL can't be parsed.
+func VMDomainFromBaseURL(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Hostname() == "" {
+		return DefaultVMDomain
 	}
+	return "vm." + strings.TrimPrefix(u.Hostname(), "api.")
+}
+
+// VMHost returns the SSH hostname of a VM.
+func (c *Client) VMHost(vmID string) string {
+	return fmt.Sprintf("%s.%s", vmID, c.VMDomain)
 }
 
 // VM represents a Vers virtual machine.
@@ -241,6 +273,26 @@ func (c *Client) GetSSHKey(vmID string) (*SSHKeyResponse, error) {
 	return &resp, nil
 }
 
+// ConnectSSH fetches a VM's SSH key and returns an SSH client for it, using
+// the client's VM domain, login user and sudo settings. Callers must call
+// Cleanup on the result.
+func (c *Client) ConnectSSH(vmID string) (*SSHClient, error) {
+	sshKey, err := c.GetSSHKey(vmID)
+	if err != nil {
+		return nil, fmt.Errorf("get SSH key for VM: %w", err)
+	}
+	ssh, err := NewSSHClient(vmID, sshKey.SSHPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	ssh.Host = c.VMHost(vmID)
+	if c.SSHUser != "" {
+		ssh.User = c.SSHUser
+	}
+	ssh.Sudo = c.SSHSudo
+	return ssh, nil
+}
+
 // WaitForBoot polls until a VM reaches "running" state, with timeout.
 func (c *Client) WaitForBoot(vmID string, timeout time.Duration) error {
 	deadline := time.Now().Add(timeout)
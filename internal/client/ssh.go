@@ -2,48 +2,102 @@ package client
 
 import (
 	"bytes"
-	"encoding/base64"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 )
 
 // SSHClient handles SSH-over-TLS connections to Vers VMs.
 // Vers VMs are reachable via SSH tunneled through TLS using
 // `openssl s_client` as a ProxyCommand.
+//
+// The private key never touches the disk: each client runs its own
+// in-process ssh-agent holding the key in memory, served on a socket in a
+// private temp directory, and the ssh processes authenticate through it.
+// Concurrent clients for the same VM get independent agents, so one
+// session's Cleanup can't pull the key out from under another.
 type SSHClient struct {
-	KeyPath string
-	VMID    string
-	Host    string
+	VMID string
+	Host string
+	User string
+	// Sudo wraps every remote command in `sudo -n sh -c`, for images where
+	// the login user is not root.
+	Sudo bool
+
+	agentDir    string
+	agentSock   string
+	listener    net.Listener
+	cleanupOnce sync.Once
 }
 
-// NewSSHClient creates a new SSH client for a VM.
-// It writes the private key to a temp file.
+// NewSSHClient creates a new SSH client for a VM with the default host
+// domain and login user (see Client.ConnectSSH for provider settings).
+// It starts an in-memory agent for the private key; callers must call
+// Cleanup to stop it.
 func NewSSHClient(vmID, privateKey string) (*SSHClient, error) {
-	keyDir := filepath.Join(os.TempDir(), "vers-tf-ssh-keys")
-	if err := os.MkdirAll(keyDir, 0o700); err != nil {
-		return nil, fmt.Errorf("create key directory: %w", err)
+	key, err := ssh.ParseRawPrivateKey([]byte(privateKey))
+	if err != nil {
+		return nil, fmt.Errorf("parse SSH key: %w", err)
+	}
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key, Comment: "vers-" + vmID}); err != nil {
+		return nil, fmt.Errorf("load SSH key into agent: %w", err)
 	}
 
-	keyPath := filepath.Join(keyDir, fmt.Sprintf("vers-%s.pem", vmID[:min(12, len(vmID))]))
-	if err := os.WriteFile(keyPath, []byte(privateKey), 0o600); err != nil {
-		return nil, fmt.Errorf("write SSH key: %w", err)
+	// MkdirTemp creates the directory with mode 0700, so only this user
+	// can reach the socket.
+	dir, err := os.MkdirTemp("", "vers-tf-agent-")
+	if err != nil {
+		return nil, fmt.Errorf("create agent directory: %w", err)
+	}
+	sock := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen("unix", sock)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("start SSH agent: %w", err)
 	}
 
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return // listener closed by Cleanup
+			}
+			go func() {
+				defer conn.Close()
+				agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+
 	return &SSHClient{
-		KeyPath: keyPath,
-		VMID:    vmID,
-		Host:    fmt.Sprintf("%s.vm.vers.sh", vmID),
+		VMID:      vmID,
+		Host:      fmt.Sprintf("%s.%s", vmID, DefaultVMDomain),
+		User:      DefaultSSHUser,
+		agentDir:  dir,
+		agentSock: sock,
+		listener:  listener,
 	}, nil
 }
 
 // sshBaseArgs returns the base SSH arguments for connecting to the VM.
 func (s *SSHClient) sshBaseArgs() []string {
 	return []string{
-		"-i", s.KeyPath,
+		"-o", "IdentityAgent=SSH_AUTH_SOCK",
 		"-o", "StrictHostKeyChecking=no",
 		"-o", "UserKnownHostsFile=/dev/null",
 		"-o", "LogLevel=ERROR",
@@ -51,100 +105,387 @@ func (s *SSHClient) sshBaseArgs() []string {
 		"-o", "ServerAliveInterval=15",
 		"-o", "ServerAliveCountMax=4",
 		"-o", fmt.Sprintf("ProxyCommand=openssl s_client -connect %s:443 -servername %s -quiet 2>/dev/null", s.Host, s.Host),
-		fmt.Sprintf("root@%s", s.Host),
+		fmt.Sprintf("%s@%s", s.User, s.Host),
 	}
 }
 
-// Exec runs a command on the VM and returns stdout.
-func (s *SSHClient) Exec(command string) (string, error) {
-	args := append(s.sshBaseArgs(), command)
-	cmd := exec.Command("ssh", args...)
+// command builds the ssh invocation for running command on the VM,
+// escalating through sudo when configured. The process authenticates
+// against this client's agent and is killed when ctx is done.
+func (s *SSHClient) command(ctx context.Context, command string) *exec.Cmd {
+	if s.Sudo {
+		command = fmt.Sprintf("sudo -n sh -c '%s'", ShellEscape(command))
+	}
+	cmd := exec.CommandContext(ctx, "ssh", append(s.sshBaseArgs(), command)...)
+	cmd.Env = append(os.Environ(), "SSH_AUTH_SOCK="+s.agentSock)
+	// Don't let a stuck stdin reader hold up Wait once ssh has exited.
+	cmd.WaitDelay = 10 * time.Second
+	return cmd
+}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+// killableCommand wraps command so that it runs in its own session and
+// process group on the VM, with the group ID recorded in pidFile. Killing
+// the local ssh process doesn't stop remote work, so on cancellation
+// killRemote uses the pid file to signal the whole group. Stdin is passed
+// through to the command, which runs under the login shell.
+func killableCommand(command, pidFile string) string {
+	return fmt.Sprintf("exec 3<&0; "+
+		"setsid sh -c 'echo $$ > \"$0\"; exec \"${SHELL:-sh}\" -c \"$1\"' '%[1]s' '%[2]s' <&3 3<&- & "+
+		"pid=$!; exec 3<&-; wait \"$pid\"; rc=$?; rm -f '%[1]s'; exit $rc",
+		pidFile, ShellEscape(command))
+}
 
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("SSH exec failed (exit %d): %s\nstderr: %s",
-			cmd.ProcessState.ExitCode(), err, stderr.String())
-	}
+// killRemote terminates the process group recorded in pidFile, escalating
+// from SIGTERM to SIGKILL after a grace period. Best-effort: it runs in a
+// fresh session with its own deadline because the caller's ctx is done.
+func (s *SSHClient) killRemote(pidFile string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
 
-	return stdout.String(), nil
+	script := fmt.Sprintf("[ -f '%[1]s' ] || exit 0; pgid=$(cat '%[1]s'); "+
+		"kill -TERM -- -\"$pgid\" 2>/dev/null; "+
+		"for i in 1 2 3 4 5 6 7 8 9 10; do kill -0 -- -\"$pgid\" 2>/dev/null || break; sleep 1; done; "+
+		"kill -KILL -- -\"$pgid\" 2>/dev/null; rm -f '%[1]s'", pidFile)
+	s.command(ctx, script).Run()
 }
 
-// ExecWithTimeout runs a command on the VM with a timeout.
-func (s *SSHClient) ExecWithTimeout(command string, timeout time.Duration) (string, error) {
-	args := append(s.sshBaseArgs(), command)
-	cmd := exec.Command("ssh", args...)
+// run executes command on the VM, tied to ctx: when ctx is cancelled or its
+// deadline passes, the local ssh process is killed and the remote process
+// group is signalled so no work is left running on the VM.
+func (s *SSHClient) run(ctx context.Context, command string, stdin io.Reader) (stdout, stderr string, exitCode int, err error) {
+	if err := ctx.Err(); err != nil {
+		return "", "", -1, err
+	}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	pidFile := fmt.Sprintf("/tmp/vers-tf-%s.pid", RandomToken())
+	cmd := s.command(ctx, killableCommand(command, pidFile))
 
-	if err := cmd.Start(); err != nil {
-		return "", fmt.Errorf("SSH start failed: %w", err)
+	var outBuf, errBuf bytes.Buffer
+	cmd.Stdin = stdin
+	cmd.Stdout = &outBuf
+	cmd.Stderr = &errBuf
+
+	runErr := cmd.Run()
+	if ctx.Err() != nil {
+		s.killRemote(pidFile)
+		return outBuf.String(), errBuf.String(), -1, ctx.Err()
+	}
+
+	exitCode = 0
+	if runErr != nil {
+		exitCode = -1
+		var exitErr *exec.ExitError
+		if errors.As(runErr, &exitErr) {
+			exitCode = exitErr.ExitCode()
+		}
+	}
+	return outBuf.String(), errBuf.String(), exitCode, runErr
+}
+
+// ExecResult is the outcome of a command that ran to completion on the VM.
+type ExecResult struct {
+	ExitCode int
+	Stdout   string
+	Stderr   string
+	Duration time.Duration
+}
+
+// Run executes a command on the VM with optional stdin and returns its exit
+// code and output. A non-zero exit is reported in the result, not as an
+// error; errors are reserved for failures to reach the VM (ssh itself exits
+// 255) and for ctx being done, in which case the remote work is killed.
+func (s *SSHClient) Run(ctx context.Context, command string, stdin io.Reader) (*ExecResult, error) {
+	start := time.Now()
+	stdout, stderr, exitCode, err := s.run(ctx, command, stdin)
+	res := &ExecResult{
+		ExitCode: exitCode,
+		Stdout:   stdout,
+		Stderr:   stderr,
+		Duration: time.Since(start),
 	}
+	switch {
+	case ctx.Err() != nil:
+		return res, fmt.Errorf("SSH command cancelled: %w", err)
+	case exitCode == 255 || exitCode == -1:
+		return res, fmt.Errorf("SSH connection failed (exit %d): %v\nstderr: %s", exitCode, err, stderr)
+	}
+	return res, nil
+}
 
-	done := make(chan error, 1)
-	go func() { done <- cmd.Wait() }()
+// Exec runs a command on the VM and returns stdout.
+func (s *SSHClient) Exec(ctx context.Context, command string) (string, error) {
+	return s.ExecWithStdin(ctx, command, nil)
+}
 
-	select {
-	case err := <-done:
-		if err != nil {
-			return stdout.String(), fmt.Errorf("SSH exec failed: %s\nstderr: %s", err, stderr.String())
+// ExecWithStdin runs a command on the VM with r connected to its stdin.
+// The reader is streamed to the remote process as it is consumed.
+func (s *SSHClient) ExecWithStdin(ctx context.Context, command string, r io.Reader) (string, error) {
+	stdout, stderr, exitCode, err := s.run(ctx, command, r)
+	if err != nil {
+		if ctx.Err() != nil {
+			return stdout, fmt.Errorf("SSH command cancelled: %w", err)
 		}
-		return stdout.String(), nil
-	case <-time.After(timeout):
-		cmd.Process.Kill()
-		return stdout.String(), fmt.Errorf("SSH command timed out after %s", timeout)
+		return stdout, fmt.Errorf("SSH exec failed (exit %d): %s\nstderr: %s", exitCode, err, stderr)
 	}
+	return stdout, nil
 }
 
-// WriteFile writes content to a file on the VM using base64 encoding
-// to safely transport arbitrary content.
-func (s *SSHClient) WriteFile(remotePath, content string) error {
-	// Ensure parent directory exists
-	dir := filepath.Dir(remotePath)
-	if dir != "." && dir != "/" {
-		if _, err := s.Exec(fmt.Sprintf("mkdir -p '%s'", shellEscape(dir))); err != nil {
-			return fmt.Errorf("mkdir on VM: %w", err)
+// ExecWithTimeout runs a command on the VM with a timeout. The remote
+// command is killed when the timeout expires or ctx is cancelled.
+func (s *SSHClient) ExecWithTimeout(ctx context.Context, command string, timeout time.Duration) (string, error) {
+	tctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	out, err := s.Exec(tctx, command)
+	if err != nil && ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+		return out, fmt.Errorf("SSH command timed out after %s", timeout)
+	}
+	return out, err
+}
+
+// FileAttrs are optional permissions and ownership applied to uploaded files.
+// Empty fields leave the corresponding attribute alone: an existing file keeps
+// its mode and ownership, a new file gets the remote umask and login user.
+type FileAttrs struct {
+	Mode  string // octal, e.g. "0755"
+	Owner string
+	Group string
+}
+
+// ParseMode parses an octal permission string such as "0644" or "755".
+func ParseMode(mode string) (os.FileMode, error) {
+	if len(mode) < 3 || len(mode) > 4 {
+		return 0, fmt.Errorf("invalid mode %q: expected 3 or 4 octal digits", mode)
+	}
+	v, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid mode %q: expected 3 or 4 octal digits", mode)
+	}
+	return os.FileMode(v), nil
+}
+
+// chownSpec returns the argument for chown, or "" when neither owner nor group is set.
+func (a FileAttrs) chownSpec() string {
+	switch {
+	case a.Owner != "" && a.Group != "":
+		return a.Owner + ":" + a.Group
+	case a.Owner != "":
+		return a.Owner
+	case a.Group != "":
+		return ":" + a.Group
+	}
+	return ""
+}
+
+// WriteFile writes content to a file on the VM.
+func (s *SSHClient) WriteFile(ctx context.Context, remotePath, content string) error {
+	return s.WriteStream(ctx, remotePath, strings.NewReader(content), FileAttrs{})
+}
+
+// WriteStream streams r to a file on the VM over the SSH session's stdin.
+// The data is never buffered in full, so memory use stays constant regardless
+// of the file size. The parent directory is created if needed.
+//
+// The data lands in a temp file next to the destination, which gets its mode
+// and ownership before being renamed into place, so the destination never
+// exists with partial content or the wrong permissions.
+func (s *SSHClient) WriteStream(ctx context.Context, remotePath string, r io.Reader, attrs FileAttrs) error {
+	if attrs.Mode != "" {
+		if _, err := ParseMode(attrs.Mode); err != nil {
+			return err
 		}
 	}
 
-	// Use base64 to safely transfer arbitrary content
-	encoded := base64.StdEncoding.EncodeToString([]byte(content))
-	cmd := fmt.Sprintf("echo '%s' | base64 -d > '%s'", encoded, shellEscape(remotePath))
-	if _, err := s.Exec(cmd); err != nil {
+	dest := ShellEscape(remotePath)
+	dir := ShellEscape(filepath.Dir(remotePath))
+
+	var script strings.Builder
+	script.WriteString("set -e; ")
+	fmt.Fprintf(&script, "mkdir -p '%s'; ", dir)
+	fmt.Fprintf(&script, "tmp=$(mktemp '%s/.vers-tf.XXXXXX'); trap 'rm -f \"$tmp\"' EXIT; ", dir)
+	script.WriteString("cat > \"$tmp\"; ")
+	if attrs.Mode != "" {
+		fmt.Fprintf(&script, "chmod %s \"$tmp\"; ", attrs.Mode)
+	} else {
+		// mktemp creates 0600 files; match what a plain redirect would have produced.
+		fmt.Fprintf(&script, "if [ -e '%s' ]; then chmod --reference='%s' \"$tmp\"; "+
+			"else chmod $(printf '%%o' $((0666 & ~0$(umask)))) \"$tmp\"; fi; ", dest, dest)
+	}
+	if spec := attrs.chownSpec(); spec != "" {
+		fmt.Fprintf(&script, "chown '%s' \"$tmp\"; ", ShellEscape(spec))
+	} else {
+		fmt.Fprintf(&script, "if [ -e '%s' ]; then chown --reference='%s' \"$tmp\" 2>/dev/null || true; fi; ", dest, dest)
+	}
+	fmt.Fprintf(&script, "mv -f \"$tmp\" '%s'; trap - EXIT", dest)
+
+	if _, err := s.ExecWithStdin(ctx, script.String(), r); err != nil {
 		return fmt.Errorf("write file %s on VM: %w", remotePath, err)
 	}
 	return nil
 }
 
-// UploadFile copies a local file to the VM via SSH stdin pipe.
-func (s *SSHClient) UploadFile(localPath, remotePath string) error {
-	content, err := os.ReadFile(localPath)
+// UploadFile streams a local file to the VM via SSH stdin pipe.
+func (s *SSHClient) UploadFile(ctx context.Context, localPath, remotePath string, attrs FileAttrs) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("open local file %s: %w", localPath, err)
+	}
+	defer f.Close()
+	return s.WriteStream(ctx, remotePath, f, attrs)
+}
+
+// UploadDir copies a local directory tree to remoteDir on the VM as a single
+// tar stream. Only files passing the include/exclude globs are sent (see
+// ListTree); their paths relative to localDir are preserved. Mode and
+// ownership in attrs are applied to every file in the stream.
+func (s *SSHClient) UploadDir(ctx context.Context, localDir, remoteDir string, include, exclude []string, attrs FileAttrs) error {
+	files, err := ListTree(localDir, include, exclude)
 	if err != nil {
-		return fmt.Errorf("read local file %s: %w", localPath, err)
+		return fmt.Errorf("list local directory %s: %w", localDir, err)
 	}
-	return s.WriteFile(remotePath, string(content))
+	return s.uploadTree(ctx, localDir, remoteDir, files, attrs)
+}
+
+// uploadTree sends the given files (relative to localDir) to remoteDir as a
+// single tar stream.
+func (s *SSHClient) uploadTree(ctx context.Context, localDir, remoteDir string, files []string, attrs FileAttrs) error {
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	tarErr := make(chan error, 1)
+	go func() {
+		err := WriteTar(pw, localDir, files, attrs)
+		pw.CloseWithError(err)
+		tarErr <- err
+	}()
+
+	// Ownership comes from the tar headers only when both owner and group
+	// are requested; a single one is applied with chown below, which, like
+	// for single files, leaves the other half alone.
+	sameOwner := attrs.Owner != "" && attrs.Group != ""
+	ownerFlag := " --no-same-owner"
+	if sameOwner {
+		ownerFlag = " --same-owner"
+	}
+	cmd := fmt.Sprintf("mkdir -p '%s' && tar -xf -%s -C '%s'",
+		ShellEscape(remoteDir), ownerFlag, ShellEscape(remoteDir))
+	_, execErr := s.ExecWithStdin(ctx, cmd, pr)
+	pr.Close()
+	// A closed pipe only means the remote side stopped reading, in which
+	// case the exec error is the one worth reporting.
+	if err := <-tarErr; err != nil && !errors.Is(err, io.ErrClosedPipe) {
+		return fmt.Errorf("archive %s: %w", localDir, err)
+	}
+	if execErr != nil {
+		return fmt.Errorf("extract to %s on VM: %w", remoteDir, execErr)
+	}
+
+	if spec := attrs.chownSpec(); spec != "" && !sameOwner {
+		cmd := fmt.Sprintf("cd '%s' && xargs -0r chown -h -- '%s'", ShellEscape(remoteDir), ShellEscape(spec))
+		if _, err := s.ExecWithStdin(ctx, cmd, strings.NewReader(strings.Join(files, "\x00"))); err != nil {
+			return fmt.Errorf("set ownership in %s on VM: %w", remoteDir, err)
+		}
+	}
+	return nil
 }
 
 // ReadFile reads a file from the VM.
-func (s *SSHClient) ReadFile(remotePath string) (string, error) {
-	return s.Exec(fmt.Sprintf("cat '%s'", shellEscape(remotePath)))
+func (s *SSHClient) ReadFile(ctx context.Context, remotePath string) (string, error) {
+	return s.Exec(ctx, fmt.Sprintf("cat '%s'", ShellEscape(remotePath)))
+}
+
+// RemoteFile describes a file on the VM.
+type RemoteFile struct {
+	Mode   string // octal, as reported by stat (e.g. "644")
+	Owner  string
+	Group  string
+	Size   int64
+	SHA256 string
+}
+
+// StatFile returns metadata and the sha256 of a file on the VM in a single
+// round trip, or nil if the file does not exist.
+func (s *SSHClient) StatFile(ctx context.Context, remotePath string) (*RemoteFile, error) {
+	p := ShellEscape(remotePath)
+	out, err := s.Exec(ctx, fmt.Sprintf(
+		"if [ -f '%s' ]; then stat -L -c '%%a %%U %%G %%s' '%s' && sha256sum < '%s'; else echo missing; fi", p, p, p))
+	if err != nil {
+		return nil, fmt.Errorf("stat %s on VM: %w", remotePath, err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) == 1 && lines[0] == "missing" {
+		return nil, nil
+	}
+	if len(lines) != 2 {
+		return nil, fmt.Errorf("stat %s on VM: unexpected output %q", remotePath, out)
+	}
+	fields := strings.Fields(lines[0])
+	sum := strings.Fields(lines[1])
+	if len(fields) != 4 || len(sum) == 0 {
+		return nil, fmt.Errorf("stat %s on VM: unexpected output %q", remotePath, out)
+	}
+	size, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("stat %s on VM: bad size %q", remotePath, fields[3])
+	}
+	return &RemoteFile{
+		Mode:   fields[0],
+		Owner:  fields[1],
+		Group:  fields[2],
+		Size:   size,
+		SHA256: sum[0],
+	}, nil
+}
+
+// HashFiles returns the SHA-256 of each remote regular file in paths, in
+// one round trip. Files that do not exist are left out of the result.
+func (s *SSHClient) HashFiles(ctx context.Context, paths []string) (map[string]string, error) {
+	out := map[string]string{}
+	if len(paths) == 0 {
+		return out, nil
+	}
+	stdout, err := s.ExecWithStdin(ctx,
+		`while IFS= read -r p; do if [ -f "$p" ]; then sha256sum < "$p" | cut -d' ' -f1; else echo -; fi; done`,
+		strings.NewReader(strings.Join(paths, "\n")+"\n"))
+	if err != nil {
+		return nil, fmt.Errorf("hash files on VM: %w", err)
+	}
+	sums := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(sums) != len(paths) {
+		return nil, fmt.Errorf("hash files on VM: expected %d hashes, got %d", len(paths), len(sums))
+	}
+	for i, sum := range sums {
+		if sum != "-" {
+			out[paths[i]] = sum
+		}
+	}
+	return out, nil
+}
+
+// RemoveFile deletes a file on the VM. A missing file is not an error.
+func (s *SSHClient) RemoveFile(ctx context.Context, remotePath string) error {
+	if _, err := s.Exec(ctx, fmt.Sprintf("rm -f '%s'", ShellEscape(remotePath))); err != nil {
+		return fmt.Errorf("remove %s on VM: %w", remotePath, err)
+	}
+	return nil
 }
 
-// WaitReachable polls until the VM is reachable via SSH.
-func (s *SSHClient) WaitReachable(timeout time.Duration) error {
+// WaitReachable polls until the VM is reachable via SSH, ctx is done, or
+// the timeout expires.
+func (s *SSHClient) WaitReachable(ctx context.Context, timeout time.Duration) error {
 	deadline := time.Now().Add(timeout)
 	var lastErr error
 	for time.Now().Before(deadline) {
-		out, err := s.ExecWithTimeout("echo ready", 15*time.Second)
+		out, err := s.ExecWithTimeout(ctx, "echo ready", 15*time.Second)
 		if err == nil && strings.TrimSpace(out) == "ready" {
 			return nil
 		}
 		lastErr = err
-		time.Sleep(3 * time.Second)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for VM %s: %w", s.VMID, ctx.Err())
+		case <-time.After(3 * time.Second):
+		}
 	}
 	if lastErr != nil {
 		return fmt.Errorf("VM %s not reachable via SSH after %s: %w", s.VMID, timeout, lastErr)
@@ -152,18 +493,73 @@ func (s *SSHClient) WaitReachable(timeout time.Duration) error {
 	return fmt.Errorf("VM %s not reachable via SSH after %s", s.VMID, timeout)
 }
 
-// Cleanup removes the temporary key file.
+// Reboot syncs the filesystem, reboots the VM and waits until it is back,
+// detected by a new kernel boot ID. timeout bounds the whole operation.
+func (s *SSHClient) Reboot(ctx context.Context, timeout time.Duration) error {
+	const bootIDCmd = "cat /proc/sys/kernel/random/boot_id"
+	deadline := time.Now().Add(timeout)
+
+	before, err := s.ExecWithTimeout(ctx, "sync && "+bootIDCmd, 2*time.Minute)
+	if err != nil {
+		return fmt.Errorf("read boot id: %w", err)
+	}
+	before = strings.TrimSpace(before)
+
+	// Detach the reboot so this session can return before the VM goes down.
+	if _, err := s.ExecWithTimeout(ctx, "nohup sh -c 'sleep 1; reboot' </dev/null >/dev/null 2>&1 &", 30*time.Second); err != nil {
+		return fmt.Errorf("trigger reboot: %w", err)
+	}
+
+	// Wait for the VM to go down (or to be back already with a new boot ID).
+	for {
+		out, err := s.ExecWithTimeout(ctx, bootIDCmd, 10*time.Second)
+		if err != nil || strings.TrimSpace(out) != before {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("VM %s did not go down within %s of the reboot", s.VMID, timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for VM %s to reboot: %w", s.VMID, ctx.Err())
+		case <-time.After(2 * time.Second):
+		}
+	}
+
+	if err := s.WaitReachable(ctx, time.Until(deadline)); err != nil {
+		return err
+	}
+	after, err := s.ExecWithTimeout(ctx, bootIDCmd, 30*time.Second)
+	if err != nil {
+		return fmt.Errorf("read boot id after reboot: %w", err)
+	}
+	if strings.TrimSpace(after) == before {
+		return fmt.Errorf("VM %s is reachable but did not reboot", s.VMID)
+	}
+	return nil
+}
+
+// Cleanup stops the agent and removes its socket directory. It is safe to
+// call more than once.
 func (s *SSHClient) Cleanup() {
-	os.Remove(s.KeyPath)
+	s.cleanupOnce.Do(func() {
+		if s.listener != nil {
+			s.listener.Close()
+		}
+		if s.agentDir != "" {
+			os.RemoveAll(s.agentDir)
+		}
+	})
 }
 
-func shellEscape(s string) string {
-	return strings.ReplaceAll(s, "'", "'\\''")
+// RandomToken returns a short random hex string for unique remote file names.
+func RandomToken() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
 }
 
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
+// ShellEscape escapes s for use inside single quotes.
+func ShellEscape(s string) string {
+	return strings.ReplaceAll(s, "'", "'\\''")
 }
@@ -0,0 +1,197 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ManifestEntry describes one file of a directory tree, locally or on the VM.
+type ManifestEntry struct {
+	Size   int64
+	SHA256 string // regular files only
+	Link   string // symlink target, symlinks only
+}
+
+// IsSymlink reports whether the entry is a symlink.
+func (e ManifestEntry) IsSymlink() bool {
+	return e.SHA256 == ""
+}
+
+// Digest identifies the content of the entry: the SHA-256 of a regular
+// file, or "symlink:<target>" for a symlink.
+func (e ManifestEntry) Digest() string {
+	if e.IsSymlink() {
+		return "symlink:" + e.Link
+	}
+	return e.SHA256
+}
+
+// SyncOptions controls SyncDir.
+type SyncOptions struct {
+	// Include and Exclude select the files to sync, as in ListTree. Remote
+	// files outside the selection are never touched.
+	Include []string
+	Exclude []string
+	// Delete removes remote files that do not exist locally.
+	Delete bool
+	// Attrs is applied to every uploaded file.
+	Attrs FileAttrs
+}
+
+// SyncResult lists the relative paths SyncDir changed on the VM.
+type SyncResult struct {
+	Uploaded []string
+	Deleted  []string
+}
+
+// LocalManifest returns the size and SHA-256 (or symlink target) of the
+// given files, relative to root.
+func LocalManifest(root string, files []string) (map[string]ManifestEntry, error) {
+	out := make(map[string]ManifestEntry, len(files))
+	for _, rel := range files {
+		local := filepath.Join(root, filepath.FromSlash(rel))
+		info, err := os.Lstat(local)
+		if err != nil {
+			return nil, err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(local)
+			if err != nil {
+				return nil, err
+			}
+			out[rel] = ManifestEntry{Size: info.Size(), Link: target}
+			continue
+		}
+
+		f, err := os.Open(local)
+		if err != nil {
+			return nil, err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", local, err)
+		}
+		out[rel] = ManifestEntry{Size: info.Size(), SHA256: hex.EncodeToString(h.Sum(nil))}
+	}
+	return out, nil
+}
+
+// RemoteManifest lists every regular file and symlink under remoteDir on the
+// VM with its size and SHA-256 (or symlink target), keyed by the path
+// relative to remoteDir, in one round trip. A missing directory yields an
+// empty manifest.
+func (s *SSHClient) RemoteManifest(ctx context.Context, remoteDir string) (map[string]ManifestEntry, error) {
+	// The listing is a sequence of NUL-terminated "type size path" and
+	// link target pairs, ended by a lone "."; the sha256sum output of every
+	// regular file follows. Paths are NUL-terminated, so any name works.
+	cmd := fmt.Sprintf("cd '%s' 2>/dev/null || exit 0; "+
+		`find . -mindepth 1 \( -type f -o -type l \) -printf '%%y %%s %%P\0%%l\0' && printf '.\0' && `+
+		`find . -type f -printf './%%P\0' | xargs -0r sha256sum -z`,
+		ShellEscape(remoteDir))
+	out, err := s.Exec(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("list %s on VM: %w", remoteDir, err)
+	}
+
+	entries := map[string]ManifestEntry{}
+	if out == "" {
+		return entries, nil
+	}
+	tokens := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	i := 0
+	for ; i < len(tokens) && tokens[i] != "."; i += 2 {
+		fields := strings.SplitN(tokens[i], " ", 3)
+		if len(fields) != 3 || i+1 >= len(tokens) {
+			return nil, fmt.Errorf("list %s on VM: unexpected entry %q", remoteDir, tokens[i])
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("list %s on VM: bad size %q", remoteDir, fields[1])
+		}
+		e := ManifestEntry{Size: size}
+		if fields[0] == "l" {
+			e.Link = tokens[i+1]
+		}
+		entries[fields[2]] = e
+	}
+	if i == len(tokens) {
+		return nil, fmt.Errorf("list %s on VM: truncated output", remoteDir)
+	}
+
+	for _, line := range tokens[i+1:] {
+		sum, p, ok := strings.Cut(line, "  ./")
+		if !ok {
+			return nil, fmt.Errorf("list %s on VM: unexpected checksum line %q", remoteDir, line)
+		}
+		if e, ok := entries[p]; ok {
+			e.SHA256 = sum
+			entries[p] = e
+		}
+	}
+	for p, e := range entries {
+		// A file that vanished between the two passes has no checksum.
+		if e.Link == "" && e.SHA256 == "" {
+			delete(entries, p)
+		}
+	}
+	return entries, nil
+}
+
+// SyncDir makes remoteDir on the VM match the selected files of localDir,
+// rsync style: the remote manifest is fetched in one round trip, only new
+// or changed files are uploaded (as one tar stream), and with opts.Delete
+// remote files that no longer exist locally are removed. Empty directories
+// are left in place.
+func (s *SSHClient) SyncDir(ctx context.Context, localDir, remoteDir string, opts SyncOptions) (*SyncResult, error) {
+	files, err := ListTree(localDir, opts.Include, opts.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("list local directory %s: %w", localDir, err)
+	}
+	local, err := LocalManifest(localDir, files)
+	if err != nil {
+		return nil, fmt.Errorf("hash local directory %s: %w", localDir, err)
+	}
+	remote, err := s.RemoteManifest(ctx, remoteDir)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &SyncResult{}
+	for _, rel := range files {
+		if r, ok := remote[rel]; !ok || r.Size != local[rel].Size || r.Digest() != local[rel].Digest() {
+			res.Uploaded = append(res.Uploaded, rel)
+		}
+	}
+	if opts.Delete {
+		for rel := range remote {
+			if _, ok := local[rel]; !ok && Selected(rel, opts.Include, opts.Exclude) {
+				res.Deleted = append(res.Deleted, rel)
+			}
+		}
+		sort.Strings(res.Deleted)
+	}
+
+	if len(res.Deleted) > 0 {
+		cmd := fmt.Sprintf("cd '%s' && xargs -0r rm -f --", ShellEscape(remoteDir))
+		if _, err := s.ExecWithStdin(ctx, cmd, strings.NewReader(strings.Join(res.Deleted, "\x00"))); err != nil {
+			return nil, fmt.Errorf("delete extraneous files in %s on VM: %w", remoteDir, err)
+		}
+	}
+	if len(res.Uploaded) > 0 {
+		if err := s.uploadTree(ctx, localDir, remoteDir, res.Uploaded, opts.Attrs); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
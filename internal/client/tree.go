@@ -0,0 +1,237 @@
+package client
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ListTree walks a local directory and returns the slash-separated paths,
+// relative to root, of every regular file and symlink that passes the
+// include and exclude globs. The result is sorted so that it can be hashed
+// deterministically.
+//
+// Globs match against the relative path. "**" matches any number of path
+// segments, and a pattern without a "/" matches the base name at any depth.
+// An empty include list includes everything. A directory matching an
+// exclude glob is skipped entirely.
+func ListTree(root string, include, exclude []string) ([]string, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+
+	var files []string
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		if matchAny(exclude, rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if !d.Type().IsRegular() && d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		if len(include) > 0 && !matchAny(include, rel) {
+			return nil
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk %s: %w", root, err)
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// HashTree writes the relative path and content of each file under root
+// into w. Symlinks contribute their target rather than the content. If sums
+// is not nil, the SHA-256 of each regular file is recorded in it, keyed by
+// relative path, from the same read.
+func HashTree(w io.Writer, root string, files []string, sums map[string]string) error {
+	for _, rel := range files {
+		local := filepath.Join(root, filepath.FromSlash(rel))
+		io.WriteString(w, rel)
+		w.Write([]byte{0})
+
+		info, err := os.Lstat(local)
+		if err != nil {
+			return err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(local)
+			if err != nil {
+				return err
+			}
+			io.WriteString(w, target)
+			continue
+		}
+
+		f, err := os.Open(local)
+		if err != nil {
+			return err
+		}
+		dst, sum := w, sha256.New()
+		if sums != nil {
+			dst = io.MultiWriter(w, sum)
+		}
+		_, err = io.Copy(dst, f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("read %s: %w", local, err)
+		}
+		if sums != nil {
+			sums[rel] = hex.EncodeToString(sum.Sum(nil))
+		}
+	}
+	return nil
+}
+
+// WriteTar writes the given files (relative to root) to w as a tar stream.
+// Local file modes are preserved unless attrs.Mode overrides them for
+// regular files. Owner and group names from attrs are recorded in the
+// headers only when both are set, since tar would turn a missing half into
+// root; otherwise ownership is left to the extracting side.
+func WriteTar(w io.Writer, root string, files []string, attrs FileAttrs) error {
+	var mode os.FileMode
+	if attrs.Mode != "" {
+		m, err := ParseMode(attrs.Mode)
+		if err != nil {
+			return err
+		}
+		mode = m
+	}
+
+	tw := tar.NewWriter(w)
+	for _, rel := range files {
+		local := filepath.Join(root, filepath.FromSlash(rel))
+		info, err := os.Lstat(local)
+		if err != nil {
+			return err
+		}
+
+		link := ""
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(local); err != nil {
+				return err
+			}
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return fmt.Errorf("tar header for %s: %w", local, err)
+		}
+		hdr.Name = rel
+		hdr.Uid, hdr.Gid = 0, 0
+		hdr.Uname, hdr.Gname = "", ""
+		if attrs.Owner != "" && attrs.Group != "" {
+			hdr.Uname, hdr.Gname = attrs.Owner, attrs.Group
+		}
+		if attrs.Mode != "" && hdr.Typeflag == tar.TypeReg {
+			hdr.Mode = int64(mode)
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		f, err := os.Open(local)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("read %s: %w", local, err)
+		}
+	}
+	return tw.Close()
+}
+
+// MatchGlob reports whether a slash-separated relative path matches pattern.
+// See ListTree for the supported syntax.
+func MatchGlob(pattern, name string) bool {
+	pattern = strings.Trim(filepath.ToSlash(pattern), "/")
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// Selected reports whether ListTree would return the relative path rel for
+// the given globs, i.e. rel is included and neither it nor any of its
+// parent directories is excluded.
+func Selected(rel string, include, exclude []string) bool {
+	parts := strings.Split(rel, "/")
+	for i := range parts {
+		if matchAny(exclude, strings.Join(parts[:i+1], "/")) {
+			return false
+		}
+	}
+	return len(include) == 0 || matchAny(include, rel)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if MatchGlob(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			pattern = pattern[1:]
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
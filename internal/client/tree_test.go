@@ -0,0 +1,100 @@
+package client
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		// Without a "/" the pattern matches the base name at any depth.
+		{"*.go", "main.go", true},
+		{"*.go", "a/b/main.go", true},
+		{"*.go", "main.go.orig", false},
+		{"node_modules", "web/node_modules", true},
+
+		// With a "/" it matches the whole relative path, segment by segment.
+		{"src/*.go", "src/main.go", true},
+		{"src/*.go", "src/a/main.go", false},
+		{"src/*.go", "lib/src/main.go", false},
+		{"/src/*.go/", "src/main.go", true},
+
+		// "**" matches any number of segments, including none.
+		{"src/**/*.go", "src/main.go", true},
+		{"src/**/*.go", "src/a/b/main.go", true},
+		{"src/**/*.go", "lib/main.go", false},
+		{"**/testdata", "testdata", true},
+		{"**/testdata", "a/b/testdata", true},
+		{"build/**", "build/a/b", true},
+		{"build/**", "builds/a", false},
+	}
+	for _, tt := range tests {
+		if got := MatchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("MatchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSelected(t *testing.T) {
+	tests := []struct {
+		rel              string
+		include, exclude []string
+		want             bool
+	}{
+		{"a/b.txt", nil, nil, true},
+		{"a/b.txt", []string{"*.txt"}, nil, true},
+		{"a/b.md", []string{"*.txt"}, nil, false},
+		{"a/b.txt", nil, []string{"*.txt"}, false},
+		// An excluded parent directory excludes everything below it.
+		{"node_modules/x/index.js", nil, []string{"node_modules"}, false},
+		{"src/.git/config", []string{"**"}, []string{".git"}, false},
+		{"src/main.go", []string{"**/*.go"}, []string{"vendor/**"}, true},
+		{"vendor/x/main.go", []string{"**/*.go"}, []string{"vendor/**"}, false},
+	}
+	for _, tt := range tests {
+		if got := Selected(tt.rel, tt.include, tt.exclude); got != tt.want {
+			t.Errorf("Selected(%q, %q, %q) = %v, want %v", tt.rel, tt.include, tt.exclude, got, tt.want)
+		}
+	}
+}
+
+func TestWriteTarOwnership(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name                 string
+		attrs                FileAttrs
+		wantUname, wantGname string
+	}{
+		{"none", FileAttrs{}, "", ""},
+		// A lone owner must not be paired with group root; it is applied
+		// with chown after extraction instead.
+		{"owner only", FileAttrs{Owner: "app"}, "", ""},
+		{"group only", FileAttrs{Group: "www-data"}, "", ""},
+		{"both", FileAttrs{Owner: "app", Group: "www-data"}, "app", "www-data"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteTar(&buf, root, []string{"a.txt"}, tt.attrs); err != nil {
+				t.Fatal(err)
+			}
+			hdr, err := tar.NewReader(&buf).Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hdr.Uname != tt.wantUname || hdr.Gname != tt.wantGname {
+				t.Errorf("owner = %q:%q, want %q:%q", hdr.Uname, hdr.Gname, tt.wantUname, tt.wantGname)
+			}
+		})
+	}
+}
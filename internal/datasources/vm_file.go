@@ -0,0 +1,177 @@
+package datasources
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+
+	"github.com/hdresearch/vers-tf/internal/client"
+)
+
+// defaultMaxFileSize caps how much a vers_vm_file data source reads by default.
+const defaultMaxFileSize = 1 << 20
+
+var _ datasource.DataSource = &VMFileDataSource{}
+var _ datasource.DataSourceWithConfigure = &VMFileDataSource{}
+
+type VMFileDataSource struct {
+	client *client.Client
+}
+
+type VMFileDataSourceModel struct {
+	VMID          types.String `tfsdk:"vm_id"`
+	Path          types.String `tfsdk:"path"`
+	Base64        types.Bool   `tfsdk:"base64"`
+	MaxSize       types.Int64  `tfsdk:"max_size"`
+	Content       types.String `tfsdk:"content"`
+	ContentBase64 types.String `tfsdk:"content_base64"`
+	SHA256        types.String `tfsdk:"sha256"`
+	Size          types.Int64  `tfsdk:"size"`
+}
+
+func NewVMFileDataSource() datasource.DataSource {
+	return &VMFileDataSource{}
+}
+
+func (d *VMFileDataSource) Metadata(_ context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_vm_file"
+}
+
+func (d *VMFileDataSource) Schema(_ context.Context, _ datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Read a file from a Vers VM, e.g. a token or version file generated during provisioning.",
+		Attributes: map[string]schema.Attribute{
+			"vm_id": schema.StringAttribute{
+				Required:    true,
+				Description: "The VM ID to read from.",
+			},
+			"path": schema.StringAttribute{
+				Required:    true,
+				Description: "Absolute path of the file on the VM.",
+			},
+			"base64": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Return the content base64-encoded in 'content_base64' instead of 'content'. Required for binary files. Default: false.",
+			},
+			"max_size": schema.Int64Attribute{
+				Optional:    true,
+				Description: fmt.Sprintf("Maximum file size in bytes. Reading a larger file is an error. Default: %d (1 MiB).", defaultMaxFileSize),
+				Validators:  []validator.Int64{int64validator.AtLeast(1)},
+			},
+			"content": schema.StringAttribute{
+				Computed:    true,
+				Description: "File content as a UTF-8 string. Null when 'base64' is true.",
+			},
+			"content_base64": schema.StringAttribute{
+				Computed:    true,
+				Description: "Base64-encoded file content. Null unless 'base64' is true.",
+			},
+			"sha256": schema.StringAttribute{
+				Computed:    true,
+				Description: "SHA-256 of the file content.",
+			},
+			"size": schema.Int64Attribute{
+				Computed:    true,
+				Description: "File size in bytes.",
+			},
+		},
+	}
+}
+
+func (d *VMFileDataSource) Configure(_ context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+	c, ok := req.ProviderData.(*client.Client)
+	if !ok {
+		resp.Diagnostics.AddError("Unexpected Data Source Configure Type", "Expected *client.Client")
+		return
+	}
+	d.client = c
+}
+
+func (d *VMFileDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var state VMFileDataSourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	vmID := state.VMID.ValueString()
+	remotePath := state.Path.ValueString()
+	maxSize := int64(defaultMaxFileSize)
+	if !state.MaxSize.IsNull() {
+		maxSize = state.MaxSize.ValueInt64()
+	}
+
+	tflog.Debug(ctx, "Reading file from Vers VM", map[string]interface{}{"vm_id": vmID, "path": remotePath})
+
+	ssh, err := d.client.ConnectSSH(vmID)
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to create SSH client", err.Error())
+		return
+	}
+	defer ssh.Cleanup()
+
+	if err := ssh.WaitReachable(ctx, 3*time.Minute); err != nil {
+		resp.Diagnostics.AddError("VM not reachable via SSH", err.Error())
+		return
+	}
+
+	info, err := ssh.StatFile(ctx, remotePath)
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to stat file on VM", err.Error())
+		return
+	}
+	if info == nil {
+		resp.Diagnostics.AddError("File not found on VM", fmt.Sprintf("%s does not exist on VM %s.", remotePath, vmID))
+		return
+	}
+	if info.Size > maxSize {
+		resp.Diagnostics.AddError("File too large",
+			fmt.Sprintf("%s is %d bytes, which exceeds max_size (%d bytes).", remotePath, info.Size, maxSize))
+		return
+	}
+
+	content, err := ssh.ReadFile(ctx, remotePath)
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to read file from VM", err.Error())
+		return
+	}
+
+	// The file may have changed since it was stat'ed, so the size limit is
+	// checked again and the hash is taken from what was actually read.
+	if int64(len(content)) > maxSize {
+		resp.Diagnostics.AddError("File too large",
+			fmt.Sprintf("%s is %d bytes, which exceeds max_size (%d bytes).", remotePath, len(content), maxSize))
+		return
+	}
+	sum := sha256.Sum256([]byte(content))
+	state.SHA256 = types.StringValue(hex.EncodeToString(sum[:]))
+	state.Size = types.Int64Value(int64(len(content)))
+	if state.Base64.ValueBool() {
+		state.Content = types.StringNull()
+		state.ContentBase64 = types.StringValue(base64.StdEncoding.EncodeToString([]byte(content)))
+	} else {
+		if !utf8.ValidString(content) {
+			resp.Diagnostics.AddError("File is not valid UTF-8",
+				fmt.Sprintf("%s contains binary data. Set base64 = true to read it as 'content_base64'.", remotePath))
+			return
+		}
+		state.Content = types.StringValue(content)
+		state.ContentBase64 = types.StringNull()
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+}
@@ -3,7 +3,9 @@ package provider
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"strconv"
 
 	"github.com/hashicorp/terraform-plugin-framework/datasource"
 	"github.com/hashicorp/terraform-plugin-framework/provider"
@@ -25,8 +27,11 @@ type VersProvider struct {
 
 // VersProviderModel is the schema model for provider configuration.
 type VersProviderModel struct {
-	APIKey  types.String `tfsdk:"api_key"`
-	BaseURL types.String `tfsdk:"base_url"`
+	APIKey   types.String `tfsdk:"api_key"`
+	BaseURL  types.String `tfsdk:"base_url"`
+	VMDomain types.String `tfsdk:"vm_domain"`
+	SSHUser  types.String `tfsdk:"ssh_user"`
+	SSHSudo  types.Bool   `tfsdk:"ssh_sudo"`
 }
 
 func New(version string) func() provider.Provider {
@@ -53,6 +58,19 @@ func (p *VersProvider) Schema(_ context.Context, _ provider.SchemaRequest, resp
 				Optional:    true,
 				Description: "Vers API base URL. Defaults to https://api.vers.sh/api/v1. Can also be set via VERS_BASE_URL.",
 			},
+			"vm_domain": schema.StringAttribute{
+				Optional: true,
+				Description: "DNS suffix under which VMs are reachable over SSH ({id}.{vm_domain}). Can also be set via VERS_VM_DOMAIN. " +
+					"Defaults to the base_url host with 'api.' replaced by 'vm.' (vm.vers.sh for the hosted service).",
+			},
+			"ssh_user": schema.StringAttribute{
+				Optional:    true,
+				Description: "Login user for SSH connections to VMs. Defaults to root. Can also be set via VERS_SSH_USER.",
+			},
+			"ssh_sudo": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Run every remote command through passwordless sudo, for hardened images that don't allow root login. Can also be set via VERS_SSH_SUDO. Default: false.",
+			},
 		},
 	}
 }
@@ -91,6 +109,32 @@ func (p *VersProvider) Configure(ctx context.Context, req provider.ConfigureRequ
 
 	c := client.New(apiKey, baseURL)
 
+	// Resolve VM domain: config > env > derived from base URL
+	if !config.VMDomain.IsNull() && !config.VMDomain.IsUnknown() && config.VMDomain.ValueString() != "" {
+		c.VMDomain = config.VMDomain.ValueString()
+	} else if v := os.Getenv("VERS_VM_DOMAIN"); v != "" {
+		c.VMDomain = v
+	}
+
+	// Resolve SSH user: config > env > root
+	if !config.SSHUser.IsNull() && !config.SSHUser.IsUnknown() && config.SSHUser.ValueString() != "" {
+		c.SSHUser = config.SSHUser.ValueString()
+	} else if v := os.Getenv("VERS_SSH_USER"); v != "" {
+		c.SSHUser = v
+	}
+
+	// Resolve sudo escalation: config > env > false
+	if !config.SSHSudo.IsNull() && !config.SSHSudo.IsUnknown() {
+		c.SSHSudo = config.SSHSudo.ValueBool()
+	} else if v := os.Getenv("VERS_SSH_SUDO"); v != "" {
+		sudo, err := strconv.ParseBool(v)
+		if err != nil {
+			resp.Diagnostics.AddError("Invalid VERS_SSH_SUDO", fmt.Sprintf("%q is not a boolean: %s", v, err))
+			return
+		}
+		c.SSHSudo = sudo
+	}
+
 	// Make client available to resources and data sources
 	resp.ResourceData = c
 	resp.DataSourceData = c
@@ -103,11 +147,17 @@ func (p *VersProvider) Resources(_ context.Context) []func() resource.Resource {
 		resources.NewVMBranchResource,
 		resources.NewVMRestoreResource,
 		resources.NewProvisionResource,
+		resources.NewVMFileResource,
+		resources.NewVMPackagesResource,
+		resources.NewVMServiceResource,
+		resources.NewVMUserResource,
+		resources.NewVMExecResource,
 	}
 }
 
 func (p *VersProvider) DataSources(_ context.Context) []func() datasource.DataSource {
 	return []func() datasource.DataSource{
 		datasources.NewVMsDataSource,
+		datasources.NewVMFileDataSource,
 	}
 }
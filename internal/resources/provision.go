@@ -3,16 +3,24 @@ package resources
 import (
 	"context"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/listplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/mapplanmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/types"
@@ -22,9 +30,9 @@ import (
 )
 
 var (
-	_ resource.Resource                = &ProvisionResource{}
-	_ resource.ResourceWithConfigure   = &ProvisionResource{}
-	_ resource.ResourceWithModifyPlan  = &ProvisionResource{}
+	_ resource.Resource               = &ProvisionResource{}
+	_ resource.ResourceWithConfigure  = &ProvisionResource{}
+	_ resource.ResourceWithModifyPlan = &ProvisionResource{}
 )
 
 type ProvisionResource struct {
@@ -32,18 +40,87 @@ type ProvisionResource struct {
 }
 
 type ProvisionResourceModel struct {
-	ID       types.String `tfsdk:"id"`
-	VMID     types.String `tfsdk:"vm_id"`
-	Files    types.List   `tfsdk:"files"`
-	Commands types.List   `tfsdk:"commands"`
-	Triggers types.Map    `tfsdk:"triggers"`
+	ID               types.String `tfsdk:"id"`
+	VMID             types.String `tfsdk:"vm_id"`
+	Files            types.List   `tfsdk:"files"`
+	Sync             types.List   `tfsdk:"sync"`
+	Scripts          types.List   `tfsdk:"scripts"`
+	Commands         types.List   `tfsdk:"commands"`
+	Steps            types.List   `tfsdk:"steps"`
+	AllowedExitCodes types.Map    `tfsdk:"allowed_exit_codes"`
+	Triggers         types.Map    `tfsdk:"triggers"`
+	ContentHash      types.Map    `tfsdk:"content_hash"`
+	DetectDrift      types.Bool   `tfsdk:"detect_drift"`
+	FileHashes       types.Map    `tfsdk:"file_hashes"`
+	SyncHashes       types.Map    `tfsdk:"sync_hashes"`
+	ResumeOnFailure  types.Bool   `tfsdk:"resume_on_failure"`
+	OnDestroy        types.Object `tfsdk:"on_destroy"`
+	OutputFiles      types.Map    `tfsdk:"output_files"`
+	OutputJSON       types.String `tfsdk:"output_json"`
+	OutputsSensitive types.Bool   `tfsdk:"outputs_sensitive"`
+	Outputs          types.Map    `tfsdk:"outputs"`
+	SensitiveOutputs types.Map    `tfsdk:"sensitive_outputs"`
+	Results          types.List   `tfsdk:"results"`
 }
 
-// FileBlock represents a file to upload to the VM.
+// FileBlock represents a file (or directory tree) to upload to the VM.
 type FileBlock struct {
-	Source      types.String `tfsdk:"source"`
-	Content     types.String `tfsdk:"content"`
-	Destination types.String `tfsdk:"destination"`
+	Source        types.String `tfsdk:"source"`
+	SourceDir     types.String `tfsdk:"source_dir"`
+	Content       types.String `tfsdk:"content"`
+	ContentBase64 types.String `tfsdk:"content_base64"`
+	Archive       types.String `tfsdk:"archive"`
+	Destination   types.String `tfsdk:"destination"`
+	Include       types.List   `tfsdk:"include"`
+	Exclude       types.List   `tfsdk:"exclude"`
+	Mode          types.String `tfsdk:"mode"`
+	Owner         types.String `tfsdk:"owner"`
+	Group         types.String `tfsdk:"group"`
+
+	StripComponents  types.Int64 `tfsdk:"strip_components"`
+	CleanDestination types.Bool  `tfsdk:"clean_destination"`
+}
+
+// CommandResult is the recorded outcome of one provisioning command.
+type CommandResult struct {
+	Name       types.String `tfsdk:"name"`
+	Command    types.String `tfsdk:"command"`
+	ExitCode   types.Int64  `tfsdk:"exit_code"`
+	Stdout     types.String `tfsdk:"stdout"`
+	Stderr     types.String `tfsdk:"stderr"`
+	DurationMS types.Int64  `tfsdk:"duration_ms"`
+}
+
+var commandResultAttrTypes = map[string]attr.Type{
+	"name":        types.StringType,
+	"command":     types.StringType,
+	"exit_code":   types.Int64Type,
+	"stdout":      types.StringType,
+	"stderr":      types.StringType,
+	"duration_ms": types.Int64Type,
+}
+
+// maxResultOutput caps how much of each output stream is kept in state.
+const maxResultOutput = 64 << 10
+
+func newCommandResult(cmd string, res *client.ExecResult) CommandResult {
+	return CommandResult{
+		Name:       types.StringNull(),
+		Command:    types.StringValue(cmd),
+		ExitCode:   types.Int64Value(int64(res.ExitCode)),
+		Stdout:     types.StringValue(strings.ToValidUTF8(truncate(res.Stdout, maxResultOutput), "")),
+		Stderr:     types.StringValue(strings.ToValidUTF8(truncate(res.Stderr, maxResultOutput), "")),
+		DurationMS: types.Int64Value(res.Duration.Milliseconds()),
+	}
+}
+
+func commandResultsList(ctx context.Context, results []CommandResult, diags *diag.Diagnostics) types.List {
+	if results == nil {
+		results = []CommandResult{}
+	}
+	l, d := types.ListValueFrom(ctx, types.ObjectType{AttrTypes: commandResultAttrTypes}, results)
+	diags.Append(d...)
+	return l
 }
 
 func NewProvisionResource() resource.Resource {
@@ -74,21 +151,66 @@ func (r *ProvisionResource) Schema(_ context.Context, _ resource.SchemaRequest,
 				},
 			},
 			"files": schema.ListNestedAttribute{
-				Optional:    true,
-				Description: "Files to upload to the VM. Specify either 'source' (local file path) or 'content' (inline string), plus 'destination' (remote path).",
+				Optional: true,
+				Description: "Files to upload to the VM. Specify one of 'source' (local file path), 'source_dir' (local directory), 'content' (inline string), " +
+					"'content_base64' (inline binary) or 'archive' (local archive to extract), plus 'destination' (remote path).",
 				NestedObject: schema.NestedAttributeObject{
 					Attributes: map[string]schema.Attribute{
 						"source": schema.StringAttribute{
 							Optional:    true,
-							Description: "Local file path to upload. Mutually exclusive with 'content'.",
+							Description: "Local file path to upload. Mutually exclusive with 'source_dir', 'content' and 'content_base64'.",
+						},
+						"source_dir": schema.StringAttribute{
+							Optional: true,
+							Description: "Local directory to upload recursively. The tree is sent as a single tar stream and extracted " +
+								"into 'destination', keeping relative paths. Mutually exclusive with 'source', 'content' and 'content_base64'.",
 						},
 						"content": schema.StringAttribute{
 							Optional:    true,
-							Description: "Inline content to write to the destination. Mutually exclusive with 'source'. Supports templatefile() output.",
+							Description: "Inline content to write to the destination. Mutually exclusive with 'source', 'source_dir' and 'content_base64'. Supports templatefile() output.",
+						},
+						"content_base64": schema.StringAttribute{
+							Optional:    true,
+							Description: "Base64-encoded inline content, for binary payloads. Decoded before writing. Use filebase64() or base64encode().",
+						},
+						"archive": schema.StringAttribute{
+							Optional: true,
+							Description: "Local .tar, .tar.gz/.tgz or .zip file, or a directory to tar on the fly, to extract into 'destination'. " +
+								"Sent as a single stream; only tar is needed on the VM.",
+						},
+						"strip_components": schema.Int64Attribute{
+							Optional:    true,
+							Description: "For 'archive': number of leading path components to strip from every entry, like tar --strip-components.",
+						},
+						"clean_destination": schema.BoolAttribute{
+							Optional:    true,
+							Description: "For 'archive': replace 'destination' with the extracted tree instead of extracting on top of it. Default: false.",
 						},
 						"destination": schema.StringAttribute{
 							Required:    true,
-							Description: "Remote path on the VM where the file will be written.",
+							Description: "Remote path on the VM where the file will be written (the target directory for 'source_dir' and 'archive').",
+						},
+						"include": schema.ListAttribute{
+							Optional:    true,
+							ElementType: types.StringType,
+							Description: "Globs selecting which files under 'source_dir' to upload (default: all). '**' matches any number of directories; a pattern without '/' matches the file name at any depth.",
+						},
+						"exclude": schema.ListAttribute{
+							Optional:    true,
+							ElementType: types.StringType,
+							Description: "Globs of files or directories under 'source_dir' to skip. Same syntax as 'include'.",
+						},
+						"mode": schema.StringAttribute{
+							Optional:    true,
+							Description: "Octal permissions for the file, e.g. \"0755\". For 'source_dir', applied to every file in the tree. Not supported for 'archive'. Default: the remote umask (existing files keep their mode).",
+						},
+						"owner": schema.StringAttribute{
+							Optional:    true,
+							Description: "User that owns the file on the VM (applied recursively to 'destination' for 'archive'). Default: the login user (existing files keep their owner).",
+						},
+						"group": schema.StringAttribute{
+							Optional:    true,
+							Description: "Group that owns the file on the VM. Default: the login user's group (existing files keep their group).",
 						},
 					},
 				},
@@ -96,20 +218,155 @@ func (r *ProvisionResource) Schema(_ context.Context, _ resource.SchemaRequest,
 					listplanmodifier.RequiresReplace(),
 				},
 			},
+			"scripts": schema.ListNestedAttribute{
+				Optional: true,
+				Description: "Local scripts to run on the VM (in order), after files are uploaded and before 'commands'. " +
+					"Each script is uploaded to a unique temp path, run with its interpreter and arguments, and removed afterwards. " +
+					"Script content is folded into the resource ID.",
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: scriptSchemaAttributes(),
+				},
+				PlanModifiers: []planmodifier.List{
+					listplanmodifier.RequiresReplace(),
+				},
+			},
 			"commands": schema.ListAttribute{
 				Optional:    true,
 				ElementType: types.StringType,
-				Description: "Shell commands to execute on the VM (in order). Run after files are uploaded.",
+				Description: "Shell commands to execute on the VM (in order). Run after files are uploaded and scripts have run.",
 				PlanModifiers: []planmodifier.List{
 					listplanmodifier.RequiresReplace(),
 				},
 			},
+			"steps": schema.ListNestedAttribute{
+				Optional: true,
+				Description: "Structured steps to execute on the VM (in order), after 'commands'. Each step takes a 'command' or " +
+					"an inline 'script' and can set its own environment, working directory, timeout, retries and guards.",
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: stepSchemaAttributes(),
+				},
+				PlanModifiers: []planmodifier.List{
+					listplanmodifier.RequiresReplace(),
+				},
+			},
+			"allowed_exit_codes": schema.MapAttribute{
+				Optional:    true,
+				ElementType: types.ListType{ElemType: types.Int64Type},
+				Description: "Exit codes that count as success for individual 'commands', keyed by the command's index in the list " +
+					"(starting at \"0\"), e.g. { \"2\" = [0, 1] }. Commands without an entry must exit 0. Scripts and steps set their own.",
+				PlanModifiers: []planmodifier.Map{
+					mapplanmodifier.RequiresReplace(),
+				},
+			},
+			"sync": schema.ListNestedAttribute{
+				Optional: true,
+				Description: "Local directories to mirror to the VM, rsync style. Each apply compares a manifest of the remote files with the " +
+					"local tree and uploads only new or changed files. Changes are applied in place and do not re-run scripts, commands or steps.",
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: syncSchemaAttributes(),
+				},
+			},
+			"sync_hashes": schema.MapAttribute{
+				Computed:    true,
+				ElementType: types.StringType,
+				Description: "Digest of each synced file, keyed by remote path: its SHA-256, or \"symlink:<target>\". " +
+					"Refreshed from the VM by Read, so the plan lists every path the next sync will upload or delete.",
+			},
 			"triggers": schema.MapAttribute{
 				Optional:    true,
 				ElementType: types.StringType,
 				Description: "Map of trigger values. When any value changes, the resource is replaced (re-provisioned). " +
 					"Use filesha256() to track file content changes.",
 			},
+			"content_hash": schema.MapAttribute{
+				Computed:    true,
+				ElementType: types.StringType,
+				Description: "SHA-256 of every local 'source' file, 'source_dir' tree, 'archive' and script, keyed by the configured path. " +
+					"Computed at plan time; a change re-provisions the VM without needing a filesha256() trigger.",
+			},
+			"detect_drift": schema.BoolAttribute{
+				Optional: true,
+				Description: "Verify uploaded files on every refresh. When enabled, Read hashes each file on the VM and the VM is " +
+					"re-provisioned if any was changed or deleted. Requires SSH access during plan. Default: false.",
+			},
+			"file_hashes": schema.MapAttribute{
+				Computed:    true,
+				ElementType: types.StringType,
+				Description: "SHA-256 of each uploaded file, keyed by remote path (one entry per file for 'source_dir'). " +
+					"Only set when 'detect_drift' is enabled; refreshed from the VM by Read.",
+			},
+			"resume_on_failure": schema.BoolAttribute{
+				Optional: true,
+				Description: "Checkpoint each completed file, script, command and step on the VM (under " + checkpointDir + ", one directory per resource). " +
+					"If provisioning fails, the partial state is saved and the next apply skips the completed work and resumes " +
+					"from the failed item. Checkpoints are removed once provisioning succeeds. An 'on_destroy' block with commands or file " +
+					"removals also clears them when the tainted resource is replaced, since it may undo the completed work; " +
+					"everything then runs again. Default: false.",
+			},
+			"on_destroy": schema.SingleNestedAttribute{
+				Optional: true,
+				Description: "Commands and file removals to run when this resource is destroyed or replaced while the VM is still running. " +
+					"Skipped quietly if the VM has already been deleted. Changing it does not re-provision.",
+				Attributes: onDestroySchemaAttributes(),
+			},
+			"output_files": schema.MapAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "Remote files to read into 'outputs' once provisioning succeeds, keyed by output name. Trailing newlines are trimmed. Files must be valid UTF-8; base64-encode binary data on the VM first.",
+			},
+			"output_json": schema.StringAttribute{
+				Optional: true,
+				Description: "Remote path of a JSON object written during provisioning. Each top-level key becomes an output; " +
+					"string values are taken as is, other values are kept as JSON. 'output_files' take precedence on conflicts.",
+			},
+			"outputs_sensitive": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Store the outputs in 'sensitive_outputs' instead of 'outputs', hiding them from plan and apply output. Default: false.",
+			},
+			"outputs": schema.MapAttribute{
+				Computed:    true,
+				ElementType: types.StringType,
+				Description: "Values read from 'output_files' and 'output_json' after provisioning.",
+			},
+			"sensitive_outputs": schema.MapAttribute{
+				Computed:    true,
+				Sensitive:   true,
+				ElementType: types.StringType,
+				Description: "Like 'outputs', but sensitive. Set instead of 'outputs' when 'outputs_sensitive' is true.",
+			},
+			"results": schema.ListNestedAttribute{
+				Computed: true,
+				Description: "Per-command results for 'scripts', 'commands' and 'steps', in execution order. Steps skipped by a guard have no entry. Output is truncated to " +
+					fmt.Sprintf("%d KiB per stream.", maxResultOutput>>10),
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"name": schema.StringAttribute{
+							Computed:    true,
+							Description: "The step name, if any.",
+						},
+						"command": schema.StringAttribute{
+							Computed:    true,
+							Description: "The command that was run (the step name or command for steps).",
+						},
+						"exit_code": schema.Int64Attribute{
+							Computed:    true,
+							Description: "Exit code of the command.",
+						},
+						"stdout": schema.StringAttribute{
+							Computed:    true,
+							Description: "Standard output.",
+						},
+						"stderr": schema.StringAttribute{
+							Computed:    true,
+							Description: "Standard error.",
+						},
+						"duration_ms": schema.Int64Attribute{
+							Computed:    true,
+							Description: "Wall-clock duration in milliseconds.",
+						},
+					},
+				},
+			},
 		},
 	}
 }
@@ -136,110 +393,27 @@ func (r *ProvisionResource) Create(ctx context.Context, req resource.CreateReque
 	vmID := plan.VMID.ValueString()
 	tflog.Info(ctx, "Provisioning Vers VM", map[string]interface{}{"vm_id": vmID})
 
-	// Get SSH credentials
-	sshKey, err := r.client.GetSSHKey(vmID)
-	if err != nil {
-		resp.Diagnostics.AddError("Failed to get SSH key for VM", err.Error())
-		return
-	}
-
-	ssh, err := client.NewSSHClient(vmID, sshKey.SSHPrivateKey)
-	if err != nil {
-		resp.Diagnostics.AddError("Failed to create SSH client", err.Error())
-		return
-	}
-	defer ssh.Cleanup()
-
-	// Wait for VM to be reachable
-	tflog.Debug(ctx, "Waiting for VM to be reachable via SSH")
-	if err := ssh.WaitReachable(3 * time.Minute); err != nil {
-		resp.Diagnostics.AddError("VM not reachable via SSH", err.Error())
-		return
-	}
-
-	// Upload files
-	if !plan.Files.IsNull() && !plan.Files.IsUnknown() {
-		var files []FileBlock
-		resp.Diagnostics.Append(plan.Files.ElementsAs(ctx, &files, false)...)
-		if resp.Diagnostics.HasError() {
-			return
-		}
-
-		for i, f := range files {
-			dest := f.Destination.ValueString()
-
-			if !f.Source.IsNull() && f.Source.ValueString() != "" {
-				// Upload from local file
-				src := f.Source.ValueString()
-				tflog.Debug(ctx, fmt.Sprintf("Uploading file %d: %s -> %s", i+1, src, dest))
-				if err := ssh.UploadFile(src, dest); err != nil {
-					resp.Diagnostics.AddError(
-						fmt.Sprintf("Failed to upload file %s -> %s", src, dest),
-						err.Error(),
-					)
-					return
-				}
-			} else if !f.Content.IsNull() && f.Content.ValueString() != "" {
-				// Write inline content
-				tflog.Debug(ctx, fmt.Sprintf("Writing inline content to %s (%d bytes)", dest, len(f.Content.ValueString())))
-				if err := ssh.WriteFile(dest, f.Content.ValueString()); err != nil {
-					resp.Diagnostics.AddError(
-						fmt.Sprintf("Failed to write content to %s", dest),
-						err.Error(),
-					)
-					return
-				}
-			} else {
-				resp.Diagnostics.AddError(
-					fmt.Sprintf("File block %d: either 'source' or 'content' must be specified", i+1),
-					"Each file block requires either a 'source' (local file path) or 'content' (inline string).",
-				)
-				return
-			}
-		}
-	}
-
-	// Run commands
-	if !plan.Commands.IsNull() && !plan.Commands.IsUnknown() {
-		var commands []string
-		resp.Diagnostics.Append(plan.Commands.ElementsAs(ctx, &commands, false)...)
-		if resp.Diagnostics.HasError() {
-			return
-		}
-
-		for i, cmd := range commands {
-			tflog.Info(ctx, fmt.Sprintf("Running command %d/%d: %s", i+1, len(commands), truncate(cmd, 100)))
-			output, err := ssh.ExecWithTimeout(cmd, 10*time.Minute)
-			if err != nil {
-				resp.Diagnostics.AddError(
-					fmt.Sprintf("Command %d failed: %s", i+1, truncate(cmd, 80)),
-					fmt.Sprintf("Error: %s\nOutput: %s", err.Error(), truncate(output, 2000)),
-				)
-				return
-			}
-			tflog.Debug(ctx, fmt.Sprintf("Command %d output: %s", i+1, truncate(output, 500)))
+	r.provision(ctx, &plan, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		if plan.ResumeOnFailure.ValueBool() {
+			// Save the partial state. Terraform taints the resource, so the
+			// next apply replaces it and resumes from the checkpoints.
+			r.setComputed(ctx, &plan, nil, &resp.Diagnostics)
+			resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
 		}
-	}
-
-	// Flush all dirty pages to disk. Without this, a subsequent vers_vm_commit
-	// can snapshot the VM before the kernel has written back file data, leading
-	// to zero-filled (corrupt) files in the committed image.
-	tflog.Debug(ctx, "Syncing filesystem to flush dirty pages before potential commit")
-	if _, err := ssh.ExecWithTimeout("sync", 2*time.Minute); err != nil {
-		resp.Diagnostics.AddError("Failed to sync filesystem after provisioning",
-			fmt.Sprintf("The 'sync' command failed: %s. A subsequent commit may produce a corrupt image.", err.Error()))
 		return
 	}
 
-	// Generate a stable ID from the provisioning inputs
-	plan.ID = types.StringValue(r.computeID(ctx, plan))
+	r.setComputed(ctx, &plan, nil, &resp.Diagnostics)
 
 	tflog.Info(ctx, "VM provisioning complete", map[string]interface{}{"vm_id": vmID})
 	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
 }
 
 func (r *ProvisionResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
-	// Provisioning is a one-shot action. Nothing to refresh from the VM.
+	// Commands and scripts are one-shot, but uploaded files (with detect_drift)
+	// and synced directories are compared with the VM, so the plan shows changes
+	// made there.
 	var state ProvisionResourceModel
 	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
 	if resp.Diagnostics.HasError() {
@@ -258,106 +432,369 @@ func (r *ProvisionResource) Read(ctx context.Context, req resource.ReadRequest,
 		return
 	}
 
+	// Compare uploaded files against what is on the VM now
+	if state.DetectDrift.ValueBool() && !state.FileHashes.IsNull() {
+		if vm.State != "running" {
+			tflog.Debug(ctx, "VM not running, skipping drift detection", map[string]interface{}{"vm_id": vm.VMID, "state": vm.State})
+		} else {
+			r.refreshFileHashes(ctx, &state, &resp.Diagnostics)
+		}
+	}
+
+	// Compare synced directories against what is on the VM now
+	if !state.SyncHashes.IsNull() && vm.State == "running" {
+		r.refreshSyncHashes(ctx, &state, &resp.Diagnostics)
+	}
+
 	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
 }
 
 func (r *ProvisionResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
-	// Triggers changed — re-provision.
-	var plan ProvisionResourceModel
+	var plan, state ProvisionResourceModel
 	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
+	// Only settings, synced directories or computed attributes changed (e.g.
+	// detect_drift turned on, or content_hash recorded for the first time
+	// after a provider upgrade) — nothing to re-run. digestPlan hashes only
+	// the inputs a configuration sets, so an ID written by an older provider
+	// still matches here.
+	digests := r.digestPlan(ctx, plan)
+	if digests.id == state.ID.ValueString() {
+		plan.Results = state.Results
+		plan.Outputs, plan.SensitiveOutputs = state.Outputs, state.SensitiveOutputs
+		if syncChanged(plan, state) {
+			r.syncNow(ctx, plan, &resp.Diagnostics)
+			if resp.Diagnostics.HasError() {
+				return
+			}
+		}
+		if !outputsConfigEqual(plan, state) {
+			r.refreshOutputs(ctx, &plan, &resp.Diagnostics)
+			if resp.Diagnostics.HasError() {
+				return
+			}
+		}
+		r.setComputed(ctx, &plan, digests, &resp.Diagnostics)
+		resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+		return
+	}
+
 	vmID := plan.VMID.ValueString()
 	tflog.Info(ctx, "Re-provisioning Vers VM (triggers changed)", map[string]interface{}{"vm_id": vmID})
 
-	// Get SSH credentials
-	sshKey, err := r.client.GetSSHKey(vmID)
+	r.provision(ctx, &plan, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	r.setComputed(ctx, &plan, digests, &resp.Diagnostics)
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+// refreshOutputs re-reads the outputs without re-provisioning, for when only
+// the output settings changed.
+func (r *ProvisionResource) refreshOutputs(ctx context.Context, plan *ProvisionResourceModel, diags *diag.Diagnostics) {
+	if !wantsOutputs(*plan) {
+		clearOutputs(plan)
+		return
+	}
+	ssh, err := r.client.ConnectSSH(plan.VMID.ValueString())
 	if err != nil {
-		resp.Diagnostics.AddError("Failed to get SSH key for VM", err.Error())
+		diags.AddError("Failed to create SSH client", err.Error())
+		return
+	}
+	defer ssh.Cleanup()
+	readOutputs(ctx, ssh, plan, diags)
+}
+
+// setComputed fills in the ID and the hashes derived from the configuration,
+// from digests if the caller already has them.
+func (r *ProvisionResource) setComputed(ctx context.Context, plan *ProvisionResourceModel, digests *planDigests, diags *diag.Diagnostics) {
+	if digests == nil {
+		digests = r.digestPlan(ctx, *plan)
+	}
+	// Generate a stable ID from the provisioning inputs
+	plan.ID = types.StringValue(digests.id)
+	plan.ContentHash = contentHashMap(ctx, *plan, digests, diags)
+	plan.FileHashes = fileHashesValue(ctx, *plan, digests, diags)
+	plan.SyncHashes = syncHashesValue(ctx, *plan, diags)
+
+	// Outputs are only read after a successful run; otherwise they stay empty.
+	if plan.Outputs.IsUnknown() {
+		plan.Outputs = types.MapNull(types.StringType)
+	}
+	if plan.SensitiveOutputs.IsUnknown() {
+		plan.SensitiveOutputs = types.MapNull(types.StringType)
+	}
+}
+
+func (r *ProvisionResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	// Provisioning is not reversible — beyond the user's on_destroy block we
+	// just remove from state. The VM itself is managed by vers_vm.
+	var state ProvisionResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
 		return
 	}
 
-	ssh, err := client.NewSSHClient(vmID, sshKey.SSHPrivateKey)
+	if !state.OnDestroy.IsNull() {
+		r.runOnDestroy(ctx, state, &resp.Diagnostics)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+	}
+
+	tflog.Debug(ctx, "Removing provision resource from state")
+}
+
+// provision connects to the VM, uploads files, syncs directories, runs
+// scripts, commands and steps, and syncs the filesystem. It records per-command results in
+// plan.Results; failures are reported through diags.
+func (r *ProvisionResource) provision(ctx context.Context, plan *ProvisionResourceModel, diags *diag.Diagnostics) {
+	vmID := plan.VMID.ValueString()
+
+	var results []CommandResult
+	defer func() {
+		plan.Results = commandResultsList(ctx, results, diags)
+	}()
+
+	// Get SSH credentials
+	ssh, err := r.client.ConnectSSH(vmID)
 	if err != nil {
-		resp.Diagnostics.AddError("Failed to create SSH client", err.Error())
+		diags.AddError("Failed to create SSH client", err.Error())
 		return
 	}
 	defer ssh.Cleanup()
 
 	// Wait for VM to be reachable
-	if err := ssh.WaitReachable(3 * time.Minute); err != nil {
-		resp.Diagnostics.AddError("VM not reachable via SSH", err.Error())
+	tflog.Debug(ctx, "Waiting for VM to be reachable via SSH")
+	if err := ssh.WaitReachable(ctx, 3*time.Minute); err != nil {
+		diags.AddError("VM not reachable via SSH", err.Error())
 		return
 	}
 
+	// Load checkpoints from an earlier, failed apply
+	var cp *checkpoints
+	if plan.ResumeOnFailure.ValueBool() {
+		if cp, err = loadCheckpoints(ctx, ssh, checkpointNamespace(ctx, *plan)); err != nil {
+			diags.AddError("Failed to read provisioning checkpoints", err.Error())
+			return
+		}
+	}
+
 	// Upload files
 	if !plan.Files.IsNull() && !plan.Files.IsUnknown() {
 		var files []FileBlock
-		resp.Diagnostics.Append(plan.Files.ElementsAs(ctx, &files, false)...)
-		if resp.Diagnostics.HasError() {
+		diags.Append(plan.Files.ElementsAs(ctx, &files, false)...)
+		if diags.HasError() {
 			return
 		}
 
-		for _, f := range files {
-			dest := f.Destination.ValueString()
-			if !f.Source.IsNull() && f.Source.ValueString() != "" {
-				if err := ssh.UploadFile(f.Source.ValueString(), dest); err != nil {
-					resp.Diagnostics.AddError(fmt.Sprintf("Failed to upload file to %s", dest), err.Error())
-					return
-				}
-			} else if !f.Content.IsNull() && f.Content.ValueString() != "" {
-				if err := ssh.WriteFile(dest, f.Content.ValueString()); err != nil {
-					resp.Diagnostics.AddError(fmt.Sprintf("Failed to write content to %s", dest), err.Error())
-					return
-				}
+		for i, f := range files {
+			key := cp.next(func(w io.Writer) { hashFileBlock(ctx, w, f, nil) })
+			if cp.completed(key) {
+				tflog.Info(ctx, fmt.Sprintf("Skipping file %d (%s): completed in an earlier apply", i+1, f.Destination.ValueString()))
+				continue
+			}
+			if err := r.uploadFileBlock(ctx, ssh, f); err != nil {
+				diags.AddError(
+					fmt.Sprintf("Failed to upload file %d to %s", i+1, f.Destination.ValueString()),
+					err.Error(),
+				)
+				return
 			}
+			cp.mark(ctx, key)
+		}
+	}
+
+	// Sync directories
+	if blocks, ok := syncBlocks(ctx, *plan); ok {
+		runSyncs(ctx, ssh, blocks, diags)
+		if diags.HasError() {
+			return
+		}
+	}
+
+	// Run scripts
+	if !plan.Scripts.IsNull() && !plan.Scripts.IsUnknown() {
+		var scripts []ScriptBlock
+		diags.Append(plan.Scripts.ElementsAs(ctx, &scripts, false)...)
+		if diags.HasError() {
+			return
+		}
+		runScripts(ctx, ssh, scripts, cp, &results, diags)
+		if diags.HasError() {
+			return
 		}
 	}
 
 	// Run commands
 	if !plan.Commands.IsNull() && !plan.Commands.IsUnknown() {
 		var commands []string
-		resp.Diagnostics.Append(plan.Commands.ElementsAs(ctx, &commands, false)...)
-		if resp.Diagnostics.HasError() {
+		diags.Append(plan.Commands.ElementsAs(ctx, &commands, false)...)
+		if diags.HasError() {
 			return
 		}
-
-		for idx, cmd := range commands {
-			tflog.Info(ctx, fmt.Sprintf("Re-provisioning command %d/%d: %s", idx+1, len(commands), truncate(cmd, 100)))
-			output, err := ssh.ExecWithTimeout(cmd, 10*time.Minute)
+		for i, cmd := range commands {
+			allowed := commandExitCodes(ctx, plan.AllowedExitCodes, i)
+			key := cp.next(func(w io.Writer) { fmt.Fprintf(w, "%s\x00%v", cmd, allowed) })
+			if cp.completed(key) {
+				tflog.Info(ctx, fmt.Sprintf("Skipping command %d/%d: completed in an earlier apply", i+1, len(commands)))
+				continue
+			}
+			tflog.Info(ctx, fmt.Sprintf("Running command %d/%d: %s", i+1, len(commands), truncate(cmd, 100)))
+			res, err := runCommand(ctx, ssh, cmd, nil, 10*time.Minute)
+			if res != nil {
+				results = append(results, newCommandResult(cmd, res))
+			}
 			if err != nil {
-				resp.Diagnostics.AddError(
-					fmt.Sprintf("Command %d failed: %s", idx+1, truncate(cmd, 80)),
-					fmt.Sprintf("Error: %s\nOutput: %s", err.Error(), truncate(output, 2000)),
+				diags.AddError(
+					fmt.Sprintf("Command %d failed: %s", i+1, truncate(cmd, 80)),
+					commandFailureDetail(err, res, allowed),
 				)
 				return
 			}
+			if !exitCodeAllowed(res.ExitCode, allowed) {
+				diags.AddError(
+					fmt.Sprintf("Command %d exited with code %d: %s", i+1, res.ExitCode, truncate(cmd, 80)),
+					commandFailureDetail(nil, res, allowed),
+				)
+				return
+			}
+			tflog.Debug(ctx, fmt.Sprintf("Command %d output: %s", i+1, truncate(res.Stdout, 500)))
+			cp.mark(ctx, key)
+		}
+	}
+
+	// Run structured steps
+	if !plan.Steps.IsNull() && !plan.Steps.IsUnknown() {
+		var steps []StepBlock
+		diags.Append(plan.Steps.ElementsAs(ctx, &steps, false)...)
+		if diags.HasError() {
+			return
+		}
+		runSteps(ctx, ssh, steps, cp, &results, diags)
+		if diags.HasError() {
+			return
+		}
+	}
+
+	// Collect outputs
+	if wantsOutputs(*plan) {
+		readOutputs(ctx, ssh, plan, diags)
+		if diags.HasError() {
+			return
 		}
 	}
 
-	// Flush all dirty pages to disk (same as Create — see comment there).
+	// Everything succeeded — drop the checkpoints before they can be committed
+	cp.clear(ctx)
+
+	// Flush all dirty pages to disk. Without this, a subsequent vers_vm_commit
+	// can snapshot the VM before the kernel has written back file data, leading
+	// to zero-filled (corrupt) files in the committed image.
 	tflog.Debug(ctx, "Syncing filesystem to flush dirty pages before potential commit")
-	if _, err := ssh.ExecWithTimeout("sync", 2*time.Minute); err != nil {
-		resp.Diagnostics.AddError("Failed to sync filesystem after re-provisioning",
+	if _, err := ssh.ExecWithTimeout(ctx, "sync", 2*time.Minute); err != nil {
+		diags.AddError("Failed to sync filesystem after provisioning",
 			fmt.Sprintf("The 'sync' command failed: %s. A subsequent commit may produce a corrupt image.", err.Error()))
 		return
 	}
+}
 
-	plan.ID = types.StringValue(r.computeID(ctx, plan))
+// uploadFileBlock transfers a single file block to the VM, applying its
+// mode and ownership as part of the write.
+func (r *ProvisionResource) uploadFileBlock(ctx context.Context, ssh *client.SSHClient, f FileBlock) error {
+	dest := f.Destination.ValueString()
+	attrs := client.FileAttrs{
+		Mode:  f.Mode.ValueString(),
+		Owner: f.Owner.ValueString(),
+		Group: f.Group.ValueString(),
+	}
 
-	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+	switch {
+	case !f.Source.IsNull() && f.Source.ValueString() != "":
+		src := f.Source.ValueString()
+		tflog.Debug(ctx, fmt.Sprintf("Uploading file %s -> %s", src, dest))
+		return ssh.UploadFile(ctx, src, dest, attrs)
+	case !f.SourceDir.IsNull() && f.SourceDir.ValueString() != "":
+		src := f.SourceDir.ValueString()
+		tflog.Debug(ctx, fmt.Sprintf("Uploading directory %s -> %s", src, dest))
+		return ssh.UploadDir(ctx, src, dest, stringList(ctx, f.Include), stringList(ctx, f.Exclude), attrs)
+	case !f.Content.IsNull():
+		tflog.Debug(ctx, fmt.Sprintf("Writing inline content to %s (%d bytes)", dest, len(f.Content.ValueString())))
+		return ssh.WriteStream(ctx, dest, strings.NewReader(f.Content.ValueString()), attrs)
+	case !f.Archive.IsNull() && f.Archive.ValueString() != "":
+		src := f.Archive.ValueString()
+		tflog.Debug(ctx, fmt.Sprintf("Extracting archive %s -> %s", src, dest))
+		opts := client.ArchiveOptions{
+			StripComponents: int(f.StripComponents.ValueInt64()),
+			Clean:           f.CleanDestination.ValueBool(),
+		}
+		return ssh.UploadArchive(ctx, src, dest, opts, attrs)
+	case !f.ContentBase64.IsNull():
+		encoded := f.ContentBase64.ValueString()
+		if _, err := base64.StdEncoding.DecodeString(encoded); err != nil {
+			return fmt.Errorf("'content_base64' is not valid base64: %w", err)
+		}
+		tflog.Debug(ctx, fmt.Sprintf("Writing base64 content to %s (%d encoded bytes)", dest, len(encoded)))
+		return ssh.WriteStream(ctx, dest, base64.NewDecoder(base64.StdEncoding, strings.NewReader(encoded)), attrs)
+	default:
+		return fmt.Errorf("each file block requires one of 'source' (local file path), 'source_dir' (local directory), " +
+			"'content' (inline string), 'content_base64' (inline binary) or 'archive' (local archive)")
+	}
 }
 
-func (r *ProvisionResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
-	// Provisioning is not reversible — we just remove from state.
-	// The VM itself is managed by vers_vm.
-	tflog.Debug(ctx, "Removing provision resource from state")
+// planDigests is the result of one pass over the local sources of a
+// configuration: the resource ID, plus the hashes content_hash and
+// file_hashes are built from. Each source is read once per plan or apply,
+// however large it is.
+type planDigests struct {
+	id    string
+	files map[string]string // local file path → SHA-256, for every regular file read
+	trees map[string]string // source_dir or archive directory → SHA-256 of its tree stream
+}
+
+// hashFile streams a local file into h, recording its SHA-256. A nil d
+// records nothing.
+func (d *planDigests) hashFile(h io.Writer, p string) error {
+	if d == nil {
+		return hashFile(h, p)
+	}
+	sum := sha256.New()
+	if err := hashFile(io.MultiWriter(h, sum), p); err != nil {
+		return err
+	}
+	d.files[p] = hex.EncodeToString(sum.Sum(nil))
+	return nil
 }
 
-// computeID generates a deterministic ID from the provisioning config.
-func (r *ProvisionResource) computeID(ctx context.Context, plan ProvisionResourceModel) string {
+// hashTree streams the given files of root into h, recording the SHA-256 of
+// the stream and of each regular file. A nil d records nothing.
+func (d *planDigests) hashTree(h io.Writer, root string, files []string) error {
+	if d == nil {
+		return client.HashTree(h, root, files, nil)
+	}
+	sum := sha256.New()
+	sums := map[string]string{}
+	if err := client.HashTree(io.MultiWriter(h, sum), root, files, sums); err != nil {
+		return err
+	}
+	d.trees[root] = hex.EncodeToString(sum.Sum(nil))
+	for rel, fileSum := range sums {
+		d.files[filepath.Join(root, filepath.FromSlash(rel))] = fileSum
+	}
+	return nil
+}
+
+// digestPlan generates a deterministic ID from the provisioning config,
+// recording the hashes of the local sources it reads.
+func (r *ProvisionResource) digestPlan(ctx context.Context, plan ProvisionResourceModel) *planDigests {
+	d := &planDigests{files: map[string]string{}, trees: map[string]string{}}
 	h := sha256.New()
 	h.Write([]byte(plan.VMID.ValueString()))
 
@@ -366,22 +803,17 @@ func (r *ProvisionResource) computeID(ctx context.Context, plan ProvisionResourc
 		var files []FileBlock
 		plan.Files.ElementsAs(ctx, &files, false)
 		for _, f := range files {
-			h.Write([]byte(f.Destination.ValueString()))
-			if !f.Source.IsNull() {
-				// Hash the file content for source files
-				content, err := os.ReadFile(f.Source.ValueString())
-				if err == nil {
-					h.Write(content)
-				} else {
-					h.Write([]byte(f.Source.ValueString()))
-				}
-			}
-			if !f.Content.IsNull() {
-				h.Write([]byte(f.Content.ValueString()))
-			}
+			hashFileBlock(ctx, h, f, d)
 		}
 	}
 
+	// Hash scripts
+	if !plan.Scripts.IsNull() && !plan.Scripts.IsUnknown() {
+		var scripts []ScriptBlock
+		plan.Scripts.ElementsAs(ctx, &scripts, false)
+		hashScripts(ctx, h, scripts, d)
+	}
+
 	// Hash commands
 	if !plan.Commands.IsNull() && !plan.Commands.IsUnknown() {
 		var commands []string
@@ -391,6 +823,30 @@ func (r *ProvisionResource) computeID(ctx context.Context, plan ProvisionResourc
 		}
 	}
 
+	// Hash steps
+	if !plan.Steps.IsNull() && !plan.Steps.IsUnknown() {
+		var steps []StepBlock
+		plan.Steps.ElementsAs(ctx, &steps, false)
+		hashSteps(ctx, h, steps)
+	}
+
+	// Hash allowed exit codes
+	if !plan.AllowedExitCodes.IsNull() && !plan.AllowedExitCodes.IsUnknown() {
+		codes := plan.AllowedExitCodes.Elements()
+		keys := make([]string, 0, len(codes))
+		for k := range codes {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if l, ok := codes[k].(types.List); ok {
+				for _, c := range allowedExitCodes(ctx, l) {
+					fmt.Fprintf(h, "exit:%s:%d", k, c)
+				}
+			}
+		}
+	}
+
 	// Hash triggers
 	if !plan.Triggers.IsNull() && !plan.Triggers.IsUnknown() {
 		triggers := plan.Triggers.Elements()
@@ -407,29 +863,291 @@ func (r *ProvisionResource) computeID(ctx context.Context, plan ProvisionResourc
 		}
 	}
 
-	return hex.EncodeToString(h.Sum(nil))[:16]
+	d.id = hex.EncodeToString(h.Sum(nil))[:16]
+	return d
 }
 
-// ModifyPlan implements custom plan behavior — force replacement when triggers change.
+// ModifyPlan implements custom plan behavior — hash local sources and force
+// replacement when they or the triggers change.
 func (r *ProvisionResource) ModifyPlan(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
-	// Skip if creating or destroying
-	if req.State.Raw.IsNull() || req.Plan.Raw.IsNull() {
+	// Skip if destroying
+	if req.Plan.Raw.IsNull() {
 		return
 	}
 
-	var planModel, stateModel ProvisionResourceModel
+	var planModel ProvisionResourceModel
 	resp.Diagnostics.Append(req.Plan.Get(ctx, &planModel)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Hash local sources so that edits show up in the plan. If a path is
+	// not known yet, or the file only appears during apply, leave the value
+	// unknown and let Create compute it.
+	digests := r.digestPlan(ctx, planModel)
+	hashes := types.MapUnknown(types.StringType)
+	planHashes, ok := contentHashes(ctx, planModel, digests)
+	if ok {
+		hashes = contentHashValue(ctx, planHashes, &resp.Diagnostics)
+	}
+	resp.Diagnostics.Append(resp.Plan.SetAttribute(ctx, path.Root("content_hash"), hashes)...)
+
+	// Expected file hashes for drift detection
+	fileHashes := types.MapNull(types.StringType)
+	if planModel.DetectDrift.IsUnknown() {
+		fileHashes = types.MapUnknown(types.StringType)
+	} else if planModel.DetectDrift.ValueBool() {
+		fileHashes = types.MapUnknown(types.StringType)
+		if m, ok := expectedFileHashes(ctx, planModel, digests); ok {
+			fileHashes = contentHashValue(ctx, m, &resp.Diagnostics)
+		}
+	}
+	resp.Diagnostics.Append(resp.Plan.SetAttribute(ctx, path.Root("file_hashes"), fileHashes)...)
+
+	// Expected synced files; a difference from state is applied in place
+	syncHashes := types.MapNull(types.StringType)
+	if !planModel.Sync.IsNull() {
+		syncHashes = types.MapUnknown(types.StringType)
+		if m, ok := expectedSyncHashes(ctx, planModel); ok {
+			syncHashes = contentHashValue(ctx, m, &resp.Diagnostics)
+		}
+	}
+	resp.Diagnostics.Append(resp.Plan.SetAttribute(ctx, path.Root("sync_hashes"), syncHashes)...)
+
+	// Skip the replacement checks if creating
+	if req.State.Raw.IsNull() {
+		return
+	}
+
+	var stateModel ProvisionResourceModel
 	resp.Diagnostics.Append(req.State.Get(ctx, &stateModel)...)
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
+	// Check if any local source changed. State written before content_hash
+	// existed has no value to compare against.
+	if !stateModel.ContentHash.IsNull() && !hashes.Equal(stateModel.ContentHash) {
+		resp.Plan.SetAttribute(ctx, path.Root("id"), types.StringUnknown())
+		resp.RequiresReplace = append(resp.RequiresReplace, path.Root("content_hash"))
+	}
+
+	// Check if files were changed or deleted on the VM (refreshed by Read)
+	if planModel.DetectDrift.ValueBool() && !stateModel.FileHashes.IsNull() && !fileHashes.Equal(stateModel.FileHashes) {
+		resp.Plan.SetAttribute(ctx, path.Root("id"), types.StringUnknown())
+		resp.RequiresReplace = append(resp.RequiresReplace, path.Root("file_hashes"))
+	}
+
 	// Check if triggers changed
 	if !triggersEqual(planModel.Triggers, stateModel.Triggers) {
 		// Force replacement by setting a new unknown ID
 		resp.Plan.SetAttribute(ctx, path.Root("id"), types.StringUnknown())
 		resp.RequiresReplace = append(resp.RequiresReplace, path.Root("id"))
 	}
+
+	// Spell out what re-provisioning will change, since the plan itself
+	// only shows the resource being replaced or updated
+	planModel.FileHashes, planModel.SyncHashes = fileHashes, syncHashes
+	replace := len(resp.RequiresReplace) > 0 || requiresReplaceChanged(planModel, stateModel)
+	reprovision := replace || digests.id != stateModel.ID.ValueString()
+	if !reprovision && syncHashes.Equal(stateModel.SyncHashes) {
+		return
+	}
+	summary := planSummary(ctx, stateModel, planModel, planHashes)
+	if summary == "" {
+		summary = "No files, scripts, commands, steps or triggers changed; other settings did."
+	}
+	vmID := planModel.VMID.ValueString()
+	if planModel.VMID.IsUnknown() {
+		vmID = "(known after apply)"
+	}
+	switch {
+	case replace:
+		resp.Diagnostics.AddWarning(fmt.Sprintf("vers_provision on VM %s will be replaced", vmID),
+			summary+"\n\nEvery file, script, command and step runs again.")
+	case reprovision:
+		resp.Diagnostics.AddWarning(fmt.Sprintf("vers_provision on VM %s will re-provision", vmID),
+			summary+"\n\nEvery file, script, command and step runs again.")
+	default:
+		resp.Diagnostics.AddWarning(fmt.Sprintf("vers_provision on VM %s will sync files", vmID), summary)
+	}
+}
+
+// requiresReplaceChanged reports whether an attribute with the
+// RequiresReplace plan modifier differs between plan and state. The
+// framework applies those modifiers itself, so they never show up in
+// ModifyPlan's resp.RequiresReplace.
+func requiresReplaceChanged(plan, state ProvisionResourceModel) bool {
+	return !plan.VMID.Equal(state.VMID) ||
+		!plan.Files.Equal(state.Files) ||
+		!plan.Scripts.Equal(state.Scripts) ||
+		!plan.Commands.Equal(state.Commands) ||
+		!plan.Steps.Equal(state.Steps) ||
+		!plan.AllowedExitCodes.Equal(state.AllowedExitCodes)
+}
+
+// contentHashes returns the SHA-256 of every local source file, source_dir
+// tree, archive and script, keyed by the configured path, as recorded in d.
+// ok is false if any path is unknown or could not be read.
+func contentHashes(ctx context.Context, plan ProvisionResourceModel, d *planDigests) (map[string]string, bool) {
+	if plan.Files.IsUnknown() || plan.Scripts.IsUnknown() {
+		return nil, false
+	}
+	out := map[string]string{}
+
+	record := func(key string, recorded ...map[string]string) bool {
+		for _, m := range recorded {
+			if sum, ok := m[key]; ok {
+				out[key] = sum
+				return true
+			}
+		}
+		return false
+	}
+
+	var files []FileBlock
+	if !plan.Files.IsNull() {
+		plan.Files.ElementsAs(ctx, &files, false)
+	}
+	for _, f := range files {
+		if f.Source.IsUnknown() || f.SourceDir.IsUnknown() || f.Archive.IsUnknown() || f.Include.IsUnknown() || f.Exclude.IsUnknown() {
+			return nil, false
+		}
+		if src := f.Source.ValueString(); src != "" && !record(src, d.files) {
+			return nil, false
+		}
+		if dir := f.SourceDir.ValueString(); dir != "" && !record(dir, d.trees) {
+			return nil, false
+		}
+		if archive := f.Archive.ValueString(); archive != "" && !record(archive, d.trees, d.files) {
+			return nil, false
+		}
+	}
+
+	var scripts []ScriptBlock
+	if !plan.Scripts.IsNull() {
+		plan.Scripts.ElementsAs(ctx, &scripts, false)
+	}
+	for _, s := range scripts {
+		if s.Source.IsUnknown() || !record(s.Source.ValueString(), d.files) {
+			return nil, false
+		}
+	}
+
+	return out, true
+}
+
+// contentHashMap computes content_hash at apply time.
+func contentHashMap(ctx context.Context, plan ProvisionResourceModel, d *planDigests, diags *diag.Diagnostics) types.Map {
+	m, ok := contentHashes(ctx, plan, d)
+	if !ok {
+		diags.AddError("Failed to hash local sources", "A 'source', 'source_dir' or script path could not be read.")
+		return types.MapNull(types.StringType)
+	}
+	return contentHashValue(ctx, m, diags)
+}
+
+func contentHashValue(ctx context.Context, m map[string]string, diags *diag.Diagnostics) types.Map {
+	v, d := types.MapValueFrom(ctx, types.StringType, m)
+	diags.Append(d...)
+	return v
+}
+
+// hashFileBlock writes the destination, content and attributes of a file
+// block into h.
+func hashFileBlock(ctx context.Context, h io.Writer, f FileBlock, d *planDigests) {
+	io.WriteString(h, f.Destination.ValueString())
+	if !f.Source.IsNull() {
+		// Hash the file content for source files
+		if err := d.hashFile(h, f.Source.ValueString()); err != nil {
+			io.WriteString(h, f.Source.ValueString())
+		}
+	}
+	if !f.SourceDir.IsNull() {
+		// Hash the relative paths and content of every file in the tree
+		if err := hashDir(ctx, h, f, d); err != nil {
+			io.WriteString(h, f.SourceDir.ValueString())
+		}
+	}
+	if !f.Content.IsNull() {
+		io.WriteString(h, f.Content.ValueString())
+	}
+	if !f.ContentBase64.IsNull() {
+		io.WriteString(h, f.ContentBase64.ValueString())
+	}
+	if !f.Archive.IsNull() {
+		// Hash the archive file, or every file of an archived directory
+		if err := hashArchive(h, f.Archive.ValueString(), d); err != nil {
+			io.WriteString(h, f.Archive.ValueString())
+		}
+		fmt.Fprintf(h, "strip:%d clean:%t", f.StripComponents.ValueInt64(), f.CleanDestination.ValueBool())
+	}
+	// Blocks without attributes hash as they did before mode/owner/group
+	// existed, so upgrading the provider doesn't change their IDs.
+	if !f.Mode.IsNull() || !f.Owner.IsNull() || !f.Group.IsNull() {
+		io.WriteString(h, f.Mode.ValueString()+f.Owner.ValueString()+":"+f.Group.ValueString())
+	}
+}
+
+// hashArchive streams the content of a local archive, or of every file of
+// a directory used as an archive, into h.
+func hashArchive(h io.Writer, localPath string, d *planDigests) error {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return d.hashFile(h, localPath)
+	}
+	files, err := client.ListTree(localPath, nil, nil)
+	if err != nil {
+		return err
+	}
+	return d.hashTree(h, localPath, files)
+}
+
+// hashFile streams the content of a local file into h.
+func hashFile(h io.Writer, localPath string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(h, f)
+	return err
+}
+
+// hashDir streams the selected files of a source_dir block into h.
+func hashDir(ctx context.Context, h io.Writer, f FileBlock, d *planDigests) error {
+	root := f.SourceDir.ValueString()
+	files, err := client.ListTree(root, stringList(ctx, f.Include), stringList(ctx, f.Exclude))
+	if err != nil {
+		return err
+	}
+	return d.hashTree(h, root, files)
+}
+
+// commandExitCodes returns the exit codes allowed for commands[i], from
+// the allowed_exit_codes map keyed by command index. Default: [0].
+func commandExitCodes(ctx context.Context, m types.Map, i int) []int64 {
+	if m.IsNull() || m.IsUnknown() {
+		return []int64{0}
+	}
+	l, ok := m.Elements()[strconv.Itoa(i)].(types.List)
+	if !ok {
+		return []int64{0}
+	}
+	return allowedExitCodes(ctx, l)
+}
+
+// stringList converts a list of strings, returning nil when it is null or unknown.
+func stringList(ctx context.Context, l types.List) []string {
+	if l.IsNull() || l.IsUnknown() {
+		return nil
+	}
+	var out []string
+	l.ElementsAs(ctx, &out, false)
+	return out
 }
 
 func triggersEqual(a, b types.Map) bool {
@@ -455,10 +1173,3 @@ func triggersEqual(a, b types.Map) bool {
 	}
 	return true
 }
-
-func truncate(s string, n int) string {
-	if len(s) <= n {
-		return s
-	}
-	return s[:n] + "..."
-}
@@ -0,0 +1,125 @@
+package resources
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+
+	"github.com/hdresearch/vers-tf/internal/client"
+)
+
+// checkpointDir holds one subdirectory per vers_provision resource, with one
+// empty marker file per completed unit of work.
+const checkpointDir = "/var/lib/vers-tf/checkpoints"
+
+// checkpoints tracks completion markers for resume_on_failure. Every unit
+// of work (file block, script, command, step) is keyed by a hash chained
+// over all units before it, so changing one unit re-runs it and everything
+// after it, while the units before it stay skipped.
+//
+// A nil *checkpoints disables checkpointing: nothing is skipped or marked.
+type checkpoints struct {
+	ssh  *client.SSHClient
+	dir  string
+	prev []byte
+	done map[string]bool
+	keys []string
+}
+
+// checkpointNamespace names the checkpoint subdirectory of a resource. It
+// covers the VM and the layout of the work (file destinations, script
+// paths, the number of commands and the step names) but not its
+// content, so editing the item that failed still resumes, while two
+// resources on the same VM keep separate markers.
+func checkpointNamespace(ctx context.Context, m ProvisionResourceModel) string {
+	h := sha256.New()
+	io.WriteString(h, m.VMID.ValueString())
+	files, _ := configFiles(ctx, m)
+	for _, f := range files {
+		fmt.Fprintf(h, "\x00file:%s", f.Destination.ValueString())
+	}
+	var scripts []ScriptBlock
+	if !m.Scripts.IsNull() && !m.Scripts.IsUnknown() {
+		m.Scripts.ElementsAs(ctx, &scripts, false)
+	}
+	for _, sc := range scripts {
+		fmt.Fprintf(h, "\x00script:%s", sc.Source.ValueString())
+	}
+	fmt.Fprintf(h, "\x00commands:%d", len(stringList(ctx, m.Commands)))
+	var steps []StepBlock
+	if !m.Steps.IsNull() && !m.Steps.IsUnknown() {
+		m.Steps.ElementsAs(ctx, &steps, false)
+	}
+	for _, st := range steps {
+		fmt.Fprintf(h, "\x00step:%s", st.Name.ValueString())
+	}
+	return checkpointDir + "/" + hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// loadCheckpoints lists the markers already in dir on the VM.
+func loadCheckpoints(ctx context.Context, ssh *client.SSHClient, dir string) (*checkpoints, error) {
+	out, err := ssh.Exec(ctx, fmt.Sprintf("ls -1 '%s' 2>/dev/null || true", dir))
+	if err != nil {
+		return nil, fmt.Errorf("list checkpoints: %w", err)
+	}
+	c := &checkpoints{ssh: ssh, dir: dir, done: map[string]bool{}}
+	for _, name := range strings.Fields(out) {
+		c.done[name] = true
+	}
+	return c, nil
+}
+
+// next returns the key of the next unit of work, whose content is written
+// into the hash by write.
+func (c *checkpoints) next(write func(io.Writer)) string {
+	if c == nil {
+		return ""
+	}
+	h := sha256.New()
+	h.Write(c.prev)
+	write(h)
+	c.prev = h.Sum(nil)
+	key := hex.EncodeToString(c.prev)
+	c.keys = append(c.keys, key)
+	return key
+}
+
+// completed reports whether the unit with key finished in an earlier apply.
+func (c *checkpoints) completed(key string) bool {
+	return c != nil && c.done[key]
+}
+
+// mark records the unit with key as completed. Failing to write a marker
+// only costs the ability to resume, so it is logged rather than returned.
+func (c *checkpoints) mark(ctx context.Context, key string) {
+	if c == nil {
+		return
+	}
+	if _, err := c.ssh.Exec(ctx, fmt.Sprintf("mkdir -p '%s' && touch '%s/%s'", c.dir, c.dir, key)); err != nil {
+		tflog.Warn(ctx, fmt.Sprintf("Failed to write checkpoint: %s", err))
+		return
+	}
+	c.done[key] = true
+}
+
+// clear removes the markers of this run after everything succeeded, so they
+// do not end up in snapshots of the VM.
+func (c *checkpoints) clear(ctx context.Context) {
+	if c == nil || len(c.keys) == 0 {
+		return
+	}
+	var b strings.Builder
+	b.WriteString("rm -f")
+	for _, k := range c.keys {
+		fmt.Fprintf(&b, " '%s/%s'", c.dir, k)
+	}
+	fmt.Fprintf(&b, " && rmdir '%s' '%s' 2>/dev/null; true", c.dir, checkpointDir)
+	if _, err := c.ssh.Exec(ctx, b.String()); err != nil {
+		tflog.Warn(ctx, fmt.Sprintf("Failed to clear checkpoints: %s", err))
+	}
+}
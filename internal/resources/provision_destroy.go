@@ -0,0 +1,190 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-framework/types/basetypes"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+
+	"github.com/hdresearch/vers-tf/internal/client"
+)
+
+const (
+	onFailureFail     = "fail"
+	onFailureContinue = "continue"
+)
+
+// OnDestroyBlock is run when a vers_provision resource is destroyed or replaced.
+type OnDestroyBlock struct {
+	Commands            types.List   `tfsdk:"commands"`
+	RemoveFiles         types.List   `tfsdk:"remove_files"`
+	RemoveUploadedFiles types.Bool   `tfsdk:"remove_uploaded_files"`
+	OnFailure           types.String `tfsdk:"on_failure"`
+}
+
+// onDestroySchemaAttributes returns the attributes of the 'on_destroy' object.
+func onDestroySchemaAttributes() map[string]schema.Attribute {
+	return map[string]schema.Attribute{
+		"commands": schema.ListAttribute{
+			Optional:    true,
+			ElementType: types.StringType,
+			Description: "Shell commands to run (in order) before the resource is removed, e.g. to deregister the VM or revoke tokens.",
+		},
+		"remove_files": schema.ListAttribute{
+			Optional:    true,
+			ElementType: types.StringType,
+			Description: "Absolute paths on the VM to delete (recursively) after the commands have run.",
+		},
+		"remove_uploaded_files": schema.BoolAttribute{
+			Optional: true,
+			Description: "Delete every file this resource uploaded via 'files' and 'sync'. For 'source_dir', the uploaded files are removed but directories are kept; " +
+				"an 'archive' destination is removed only with 'clean_destination'. Default: false.",
+		},
+		"on_failure": schema.StringAttribute{
+			Optional: true,
+			Description: fmt.Sprintf("What to do when a command or removal fails: %q stops the destroy with an error, %q logs a warning and removes the resource anyway. Default: %q.",
+				onFailureFail, onFailureContinue, onFailureFail),
+		},
+	}
+}
+
+// runOnDestroy executes the on_destroy block of state. It does nothing if the
+// VM no longer exists or is not running.
+func (r *ProvisionResource) runOnDestroy(ctx context.Context, state ProvisionResourceModel, diags *diag.Diagnostics) {
+	var od OnDestroyBlock
+	diags.Append(state.OnDestroy.As(ctx, &od, basetypes.ObjectAsOptions{})...)
+	if diags.HasError() {
+		return
+	}
+
+	vmID := state.VMID.ValueString()
+	vm, err := r.client.GetVM(vmID)
+	if err != nil {
+		diags.AddError("Failed to verify VM exists", err.Error())
+		return
+	}
+	if vm == nil {
+		tflog.Info(ctx, "VM already deleted, skipping on_destroy", map[string]interface{}{"vm_id": vmID})
+		return
+	}
+	if vm.State != "running" {
+		tflog.Warn(ctx, "VM not running, skipping on_destroy", map[string]interface{}{"vm_id": vmID, "state": vm.State})
+		return
+	}
+
+	// fail reports a problem according to on_failure and says whether to stop.
+	fail := func(summary, detail string) bool {
+		if od.OnFailure.ValueString() == onFailureContinue {
+			diags.AddWarning(summary, detail)
+			return false
+		}
+		diags.AddError(summary, detail+"\n\nSet on_destroy.on_failure = \"continue\" to remove the resource anyway.")
+		return true
+	}
+
+	ssh, err := r.client.ConnectSSH(vmID)
+	if err != nil {
+		fail("Failed to create SSH client", err.Error())
+		return
+	}
+	defer ssh.Cleanup()
+
+	if err := ssh.WaitReachable(ctx, 3*time.Minute); err != nil {
+		fail("VM not reachable via SSH", err.Error())
+		return
+	}
+
+	// Commands and removals may undo work that a failed apply checkpointed,
+	// so the replacement must not skip it. A block without either leaves
+	// the checkpoints for the replacement to resume from.
+	undoes := len(stringList(ctx, od.Commands)) > 0 || len(stringList(ctx, od.RemoveFiles)) > 0 || od.RemoveUploadedFiles.ValueBool()
+	if state.ResumeOnFailure.ValueBool() && undoes {
+		cmd := fmt.Sprintf("rm -rf '%s'; rmdir '%s' 2>/dev/null; true", checkpointNamespace(ctx, state), checkpointDir)
+		if _, err := ssh.ExecWithTimeout(ctx, cmd, time.Minute); err != nil {
+			if fail("Failed to clear provisioning checkpoints", err.Error()) {
+				return
+			}
+		}
+	}
+
+	commands := stringList(ctx, od.Commands)
+	for i, cmd := range commands {
+		tflog.Info(ctx, fmt.Sprintf("Running destroy command %d/%d: %s", i+1, len(commands), truncate(cmd, 100)))
+		res, err := runCommand(ctx, ssh, cmd, nil, 10*time.Minute)
+		if err != nil {
+			if fail(fmt.Sprintf("Destroy command %d failed: %s", i+1, truncate(cmd, 80)), commandFailureDetail(err, res, []int64{0})) {
+				return
+			}
+			continue
+		}
+		if res.ExitCode != 0 {
+			if fail(fmt.Sprintf("Destroy command %d exited with code %d: %s", i+1, res.ExitCode, truncate(cmd, 80)),
+				commandFailureDetail(nil, res, []int64{0})) {
+				return
+			}
+		}
+	}
+
+	remove := stringList(ctx, od.RemoveFiles)
+	if od.RemoveUploadedFiles.ValueBool() {
+		remove = append(remove, uploadedPaths(ctx, state)...)
+	}
+	if len(remove) > 0 {
+		var b strings.Builder
+		b.WriteString("rm -rf --")
+		for _, p := range remove {
+			fmt.Fprintf(&b, " '%s'", client.ShellEscape(p))
+		}
+		tflog.Info(ctx, fmt.Sprintf("Removing %d path(s) from the VM", len(remove)))
+		if _, err := ssh.ExecWithTimeout(ctx, b.String(), 2*time.Minute); err != nil {
+			fail("Failed to remove files from VM", err.Error())
+			return
+		}
+	}
+}
+
+// uploadedPaths lists the remote paths written by the file and sync blocks
+// of state. An archive's destination is included only with clean_destination, when
+// the whole directory came from the archive.
+func uploadedPaths(ctx context.Context, state ProvisionResourceModel) []string {
+	files, _ := configFiles(ctx, state)
+	out := sortedKeys(stringMap(ctx, state.SyncHashes))
+	for _, f := range files {
+		if !f.Archive.IsNull() && f.CleanDestination.ValueBool() {
+			out = append(out, f.Destination.ValueString())
+		}
+	}
+
+	// With detect_drift the exact list was recorded at apply time.
+	if !state.FileHashes.IsNull() {
+		return append(out, sortedKeys(stringMap(ctx, state.FileHashes))...)
+	}
+
+	for _, f := range files {
+		dest := f.Destination.ValueString()
+		if !f.Archive.IsNull() {
+			continue
+		}
+		if f.SourceDir.IsNull() {
+			out = append(out, dest)
+			continue
+		}
+		// The local tree may have changed since it was uploaded; this is
+		// a best effort at what is on the VM.
+		rels, err := client.ListTree(f.SourceDir.ValueString(), stringList(ctx, f.Include), stringList(ctx, f.Exclude))
+		if err != nil {
+			continue
+		}
+		for _, rel := range rels {
+			out = append(out, path.Join(dest, rel))
+		}
+	}
+	return out
+}
@@ -0,0 +1,149 @@
+package resources
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+
+	"github.com/hdresearch/vers-tf/internal/client"
+)
+
+// expectedFileHashes returns the SHA-256 each uploaded file should have on
+// the VM, keyed by remote path. Every file of a source_dir tree gets its own
+// entry; extracted archives are not tracked. ok is false if any input is not known yet or a local source cannot
+// be read.
+func expectedFileHashes(ctx context.Context, plan ProvisionResourceModel, d *planDigests) (map[string]string, bool) {
+	out := map[string]string{}
+	if plan.Files.IsNull() {
+		return out, true
+	}
+	if plan.Files.IsUnknown() {
+		return nil, false
+	}
+
+	var files []FileBlock
+	if diags := plan.Files.ElementsAs(ctx, &files, false); diags.HasError() {
+		return nil, false
+	}
+
+	for _, f := range files {
+		for _, v := range []types.String{f.Destination, f.Source, f.SourceDir, f.Content, f.ContentBase64, f.Archive} {
+			if v.IsUnknown() {
+				return nil, false
+			}
+		}
+		dest := f.Destination.ValueString()
+
+		switch {
+		case !f.Source.IsNull():
+			sum, ok := d.files[f.Source.ValueString()]
+			if !ok {
+				return nil, false
+			}
+			out[dest] = sum
+		case !f.SourceDir.IsNull():
+			if f.Include.IsUnknown() || f.Exclude.IsUnknown() {
+				return nil, false
+			}
+			root := f.SourceDir.ValueString()
+			rels, err := client.ListTree(root, stringList(ctx, f.Include), stringList(ctx, f.Exclude))
+			if err != nil {
+				return nil, false
+			}
+			for _, rel := range rels {
+				local := filepath.Join(root, filepath.FromSlash(rel))
+				if info, err := os.Lstat(local); err != nil || !info.Mode().IsRegular() {
+					continue
+				}
+				sum, ok := d.files[local]
+				if !ok {
+					return nil, false
+				}
+				out[path.Join(dest, rel)] = sum
+			}
+		case !f.Content.IsNull():
+			out[dest] = sha256Hex([]byte(f.Content.ValueString()))
+		case !f.ContentBase64.IsNull():
+			data, err := base64.StdEncoding.DecodeString(f.ContentBase64.ValueString())
+			if err != nil {
+				return nil, false
+			}
+			out[dest] = sha256Hex(data)
+		}
+	}
+	return out, true
+}
+
+// fileHashesValue computes file_hashes at apply time. It is null unless
+// detect_drift is enabled.
+func fileHashesValue(ctx context.Context, plan ProvisionResourceModel, d *planDigests, diags *diag.Diagnostics) types.Map {
+	if !plan.DetectDrift.ValueBool() {
+		return types.MapNull(types.StringType)
+	}
+	m, ok := expectedFileHashes(ctx, plan, d)
+	if !ok {
+		diags.AddError("Failed to hash uploaded files", "A local 'source' or 'source_dir' file could not be read.")
+		return types.MapNull(types.StringType)
+	}
+	return contentHashValue(ctx, m, diags)
+}
+
+// refreshFileHashes replaces state.FileHashes with the hashes of the files
+// currently on the VM. A file that was deleted drops out of the map, so the
+// next plan shows it as changed. If the VM cannot be reached the last known
+// hashes are kept.
+func (r *ProvisionResource) refreshFileHashes(ctx context.Context, state *ProvisionResourceModel, diags *diag.Diagnostics) {
+	recorded := stringMap(ctx, state.FileHashes)
+	paths := make([]string, 0, len(recorded))
+	for p := range recorded {
+		if strings.Contains(p, "\n") {
+			continue
+		}
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	ssh, err := r.client.ConnectSSH(state.VMID.ValueString())
+	if err != nil {
+		diags.AddWarning("Skipping drift detection", err.Error())
+		return
+	}
+	defer ssh.Cleanup()
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+	actual, err := ssh.HashFiles(ctx, paths)
+	if err != nil {
+		diags.AddWarning("Skipping drift detection", err.Error())
+		return
+	}
+
+	for p, sum := range recorded {
+		if strings.Contains(p, "\n") {
+			// Can't be passed to the VM line by line; assume unchanged.
+			actual[p] = sum
+		}
+	}
+	for _, p := range paths {
+		if actual[p] != recorded[p] {
+			tflog.Info(ctx, "Provisioned file drifted on VM", map[string]interface{}{"path": p})
+		}
+	}
+	state.FileHashes = contentHashValue(ctx, actual, diags)
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,87 @@
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+
+	"github.com/hdresearch/vers-tf/internal/client"
+)
+
+// wantsOutputs reports whether the configuration declares any outputs.
+func wantsOutputs(plan ProvisionResourceModel) bool {
+	return (!plan.OutputFiles.IsNull() && len(plan.OutputFiles.Elements()) > 0) ||
+		(!plan.OutputJSON.IsNull() && plan.OutputJSON.ValueString() != "")
+}
+
+// outputsConfigEqual reports whether the output settings of a and b match.
+func outputsConfigEqual(a, b ProvisionResourceModel) bool {
+	return a.OutputFiles.Equal(b.OutputFiles) && a.OutputJSON.Equal(b.OutputJSON) &&
+		a.OutputsSensitive.ValueBool() == b.OutputsSensitive.ValueBool()
+}
+
+// readOutputs collects the declared output files and the output JSON object
+// from the VM into plan.Outputs, or plan.SensitiveOutputs when
+// outputs_sensitive is set.
+func readOutputs(ctx context.Context, ssh *client.SSHClient, plan *ProvisionResourceModel, diags *diag.Diagnostics) {
+	values := map[string]string{}
+
+	if p := plan.OutputJSON.ValueString(); p != "" {
+		raw, err := ssh.ReadFile(ctx, p)
+		if err != nil {
+			diags.AddError("Failed to read output_json from VM", err.Error())
+			return
+		}
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(raw), &obj); err != nil {
+			diags.AddError("Invalid output_json",
+				fmt.Sprintf("%s must contain a JSON object: %s", p, err))
+			return
+		}
+		for k, v := range obj {
+			// Strings are taken as is; anything else stays JSON for jsondecode().
+			var s string
+			if err := json.Unmarshal(v, &s); err == nil {
+				values[k] = s
+			} else {
+				values[k] = string(v)
+			}
+		}
+	}
+
+	files := stringMap(ctx, plan.OutputFiles)
+	for _, name := range sortedKeys(files) {
+		content, err := ssh.ReadFile(ctx, files[name])
+		if err != nil {
+			diags.AddError(fmt.Sprintf("Failed to read output %q from VM", name), err.Error())
+			return
+		}
+		if !utf8.ValidString(content) {
+			diags.AddError(fmt.Sprintf("Output %q is not valid UTF-8", name),
+				fmt.Sprintf("%s contains binary data. Base64-encode it on the VM, e.g. with base64 -w0, and read the encoded file instead.", files[name]))
+			return
+		}
+		values[name] = strings.TrimRight(content, "\r\n")
+	}
+
+	m, d := types.MapValueFrom(ctx, types.StringType, values)
+	diags.Append(d...)
+	if plan.OutputsSensitive.ValueBool() {
+		plan.Outputs = types.MapNull(types.StringType)
+		plan.SensitiveOutputs = m
+	} else {
+		plan.Outputs = m
+		plan.SensitiveOutputs = types.MapNull(types.StringType)
+	}
+}
+
+// clearOutputs sets the computed outputs to null when none are declared.
+func clearOutputs(plan *ProvisionResourceModel) {
+	plan.Outputs = types.MapNull(types.StringType)
+	plan.SensitiveOutputs = types.MapNull(types.StringType)
+}
@@ -0,0 +1,192 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// changeEntry is one item of the configuration compared by planSummary.
+type changeEntry struct {
+	key         string // identity across state and plan
+	label       string // shown in the summary
+	fingerprint string // differs when the item changed
+}
+
+// planSummary describes, one line per item, what an update of state to plan
+// changes: files to add, modify or remove, and added, changed or removed
+// scripts, commands, steps and triggers. planHashes holds the content hashes
+// of the plan's local sources (nil if unknown); the state's come from its
+// content_hash. The result is empty if none of those changed.
+func planSummary(ctx context.Context, state, plan ProvisionResourceModel, planHashes map[string]string) string {
+	var b strings.Builder
+	section := func(title string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "%s:\n", title)
+		for _, l := range lines {
+			fmt.Fprintf(&b, "  %s\n", l)
+		}
+	}
+	unknown := []string{"(known after apply)"}
+	stateHashes := stringMap(ctx, state.ContentHash)
+
+	// Per-file hashes are exact; without detect_drift, compare file blocks.
+	switch {
+	case plan.Files.IsUnknown() || planHashes == nil:
+		section("Files", unknown)
+	case !state.FileHashes.IsNull() && !plan.FileHashes.IsNull() && !plan.FileHashes.IsUnknown():
+		section("Files", diffEntries(hashEntries(ctx, state.FileHashes), hashEntries(ctx, plan.FileHashes)))
+	default:
+		section("Files", diffEntries(fileEntries(ctx, state, stateHashes), fileEntries(ctx, plan, planHashes)))
+	}
+
+	if plan.SyncHashes.IsUnknown() {
+		section("Sync", unknown)
+	} else {
+		section("Sync", diffEntries(hashEntries(ctx, state.SyncHashes), hashEntries(ctx, plan.SyncHashes)))
+	}
+
+	if plan.Scripts.IsUnknown() || planHashes == nil {
+		section("Scripts", unknown)
+	} else {
+		section("Scripts", diffEntries(scriptEntries(ctx, state, stateHashes), scriptEntries(ctx, plan, planHashes)))
+	}
+
+	if plan.Commands.IsUnknown() {
+		section("Commands", unknown)
+	} else {
+		section("Commands", diffEntries(commandEntries(ctx, state), commandEntries(ctx, plan)))
+	}
+
+	if plan.Steps.IsUnknown() {
+		section("Steps", unknown)
+	} else {
+		section("Steps", diffEntries(stepEntries(ctx, state), stepEntries(ctx, plan)))
+	}
+
+	if plan.Triggers.IsUnknown() {
+		section("Triggers", unknown)
+	} else {
+		section("Triggers", diffEntries(hashEntries(ctx, state.Triggers), hashEntries(ctx, plan.Triggers)))
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// diffEntries returns "+ label" for each entry only in next, "~ label" for
+// each entry whose fingerprint changed, and "- label" for each entry only
+// in prev, in configuration order. Repeated keys are matched in order.
+func diffEntries(prev, next []changeEntry) []string {
+	keyed := func(entries []changeEntry) ([]string, map[string]changeEntry) {
+		keys := make([]string, 0, len(entries))
+		m := map[string]changeEntry{}
+		seen := map[string]int{}
+		for _, e := range entries {
+			k := fmt.Sprintf("%s\x00%d", e.key, seen[e.key])
+			seen[e.key]++
+			keys = append(keys, k)
+			m[k] = e
+		}
+		return keys, m
+	}
+	prevKeys, before := keyed(prev)
+	nextKeys, after := keyed(next)
+
+	var added, changed, removed []string
+	for _, k := range nextKeys {
+		if p, ok := before[k]; !ok {
+			added = append(added, "+ "+after[k].label)
+		} else if p.fingerprint != after[k].fingerprint {
+			changed = append(changed, "~ "+after[k].label)
+		}
+	}
+	for _, k := range prevKeys {
+		if _, ok := after[k]; !ok {
+			removed = append(removed, "- "+before[k].label)
+		}
+	}
+	return append(append(added, changed...), removed...)
+}
+
+// hashEntries turns a map of path (or name) to hash into entries, sorted by
+// key. Only the keys are shown.
+func hashEntries(ctx context.Context, m types.Map) []changeEntry {
+	values := stringMap(ctx, m)
+	out := make([]changeEntry, 0, len(values))
+	for _, k := range sortedKeys(values) {
+		out = append(out, changeEntry{key: k, label: k, fingerprint: values[k]})
+	}
+	return out
+}
+
+// fileEntries keys each file block by destination. Its fingerprint covers
+// the block's settings and the content hash of its local source.
+func fileEntries(ctx context.Context, m ProvisionResourceModel, hashes map[string]string) []changeEntry {
+	files, ok := configFiles(ctx, m)
+	if !ok {
+		return nil
+	}
+	elems := m.Files.Elements()
+	out := make([]changeEntry, 0, len(files))
+	for i, f := range files {
+		fp := elems[i].String()
+		for _, src := range []types.String{f.Source, f.SourceDir, f.Archive} {
+			if p := src.ValueString(); p != "" {
+				fp += "\x00" + hashes[p]
+			}
+		}
+		dest := f.Destination.ValueString()
+		out = append(out, changeEntry{key: dest, label: dest, fingerprint: fp})
+	}
+	return out
+}
+
+func scriptEntries(ctx context.Context, m ProvisionResourceModel, hashes map[string]string) []changeEntry {
+	if m.Scripts.IsNull() || m.Scripts.IsUnknown() {
+		return nil
+	}
+	var scripts []ScriptBlock
+	if diags := m.Scripts.ElementsAs(ctx, &scripts, false); diags.HasError() {
+		return nil
+	}
+	elems := m.Scripts.Elements()
+	out := make([]changeEntry, 0, len(scripts))
+	for i, s := range scripts {
+		src := s.Source.ValueString()
+		out = append(out, changeEntry{key: src, label: truncate(s.label(ctx), 100), fingerprint: elems[i].String() + "\x00" + hashes[src]})
+	}
+	return out
+}
+
+// commandEntries keys each command by its text, so a command can only be
+// added or removed.
+func commandEntries(ctx context.Context, m ProvisionResourceModel) []changeEntry {
+	var out []changeEntry
+	for _, cmd := range stringList(ctx, m.Commands) {
+		out = append(out, changeEntry{key: cmd, label: truncate(cmd, 100)})
+	}
+	return out
+}
+
+// stepEntries keys each step by its name, or its command if it has none.
+// Sensitive values only feed the fingerprint and are never shown.
+func stepEntries(ctx context.Context, m ProvisionResourceModel) []changeEntry {
+	if m.Steps.IsNull() || m.Steps.IsUnknown() {
+		return nil
+	}
+	var steps []StepBlock
+	if diags := m.Steps.ElementsAs(ctx, &steps, false); diags.HasError() {
+		return nil
+	}
+	elems := m.Steps.Elements()
+	out := make([]changeEntry, 0, len(steps))
+	for i, s := range steps {
+		label := s.label(i)
+		out = append(out, changeEntry{key: label, label: label, fingerprint: elems[i].String()})
+	}
+	return out
+}
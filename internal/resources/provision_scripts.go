@@ -0,0 +1,149 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+
+	"github.com/hdresearch/vers-tf/internal/client"
+)
+
+const defaultScriptInterpreter = "bash"
+
+// ScriptBlock is a local script uploaded to the VM and run once.
+type ScriptBlock struct {
+	Source           types.String `tfsdk:"source"`
+	Args             types.List   `tfsdk:"args"`
+	Interpreter      types.String `tfsdk:"interpreter"`
+	Env              types.Map    `tfsdk:"env"`
+	AllowedExitCodes types.List   `tfsdk:"allowed_exit_codes"`
+}
+
+// scriptSchemaAttributes returns the attributes of a 'scripts' element.
+func scriptSchemaAttributes() map[string]schema.Attribute {
+	return map[string]schema.Attribute{
+		"source": schema.StringAttribute{
+			Required:    true,
+			Description: "Local path of the script to run.",
+		},
+		"args": schema.ListAttribute{
+			Optional:    true,
+			ElementType: types.StringType,
+			Description: "Arguments passed to the script. Each is quoted, so spaces and shell metacharacters are passed literally.",
+		},
+		"interpreter": schema.StringAttribute{
+			Optional:    true,
+			Description: "Command used to run the script, e.g. \"python3\" or \"bash -eu\". Default: \"" + defaultScriptInterpreter + "\".",
+		},
+		"env": schema.MapAttribute{
+			Optional:    true,
+			ElementType: types.StringType,
+			Description: "Environment variables for the script. Sent over stdin, so they never appear on a command line.",
+		},
+		"allowed_exit_codes": schema.ListAttribute{
+			Optional:    true,
+			ElementType: types.Int64Type,
+			Description: "Exit codes that count as success for this script. Default: [0].",
+		},
+	}
+}
+
+// label returns how the script appears in logs and 'results'.
+func (s ScriptBlock) label(ctx context.Context) string {
+	parts := []string{s.interpreter(), s.Source.ValueString()}
+	parts = append(parts, stringList(ctx, s.Args)...)
+	return strings.Join(parts, " ")
+}
+
+func (s ScriptBlock) interpreter() string {
+	if s.Interpreter.IsNull() || s.Interpreter.ValueString() == "" {
+		return defaultScriptInterpreter
+	}
+	return s.Interpreter.ValueString()
+}
+
+// runScripts uploads each script to a unique temp path, runs it, and
+// removes it again, appending a result for every script that ran. It stops
+// at the first failure.
+func runScripts(ctx context.Context, ssh *client.SSHClient, scripts []ScriptBlock, cp *checkpoints, results *[]CommandResult, diags *diag.Diagnostics) {
+	for i, s := range scripts {
+		label := s.label(ctx)
+		allowed := allowedExitCodes(ctx, s.AllowedExitCodes)
+		summary := fmt.Sprintf("Script %d (%s)", i+1, s.Source.ValueString())
+
+		key := cp.next(func(w io.Writer) { hashScripts(ctx, w, []ScriptBlock{s}, nil) })
+		if cp.completed(key) {
+			tflog.Info(ctx, fmt.Sprintf("Skipping script %d/%d (%s): completed in an earlier apply", i+1, len(scripts), label))
+			continue
+		}
+
+		preamble, err := envPreamble(stringMap(ctx, s.Env))
+		if err != nil {
+			diags.AddError(summary+": invalid environment", err.Error())
+			return
+		}
+
+		remotePath := "/tmp/vers-tf-script-" + client.RandomToken()
+		tflog.Info(ctx, fmt.Sprintf("Running script %d/%d: %s", i+1, len(scripts), label))
+		if err := ssh.UploadFile(ctx, s.Source.ValueString(), remotePath, client.FileAttrs{Mode: "0700"}); err != nil {
+			diags.AddError(summary+": upload failed", err.Error())
+			return
+		}
+
+		cmd := s.interpreter() + " '" + client.ShellEscape(remotePath) + "'"
+		for _, a := range stringList(ctx, s.Args) {
+			cmd += " '" + client.ShellEscape(a) + "'"
+		}
+		res, err := runScript(ctx, ssh, preamble, cmd, 10*time.Minute)
+
+		// The script may have failed because ctx was cancelled; the temp
+		// file is removed regardless.
+		rmCmd := fmt.Sprintf("rm -f '%s'", client.ShellEscape(remotePath))
+		if _, rmErr := ssh.ExecWithTimeout(context.WithoutCancel(ctx), rmCmd, 30*time.Second); rmErr != nil {
+			tflog.Warn(ctx, fmt.Sprintf("Failed to remove %s: %s", remotePath, rmErr))
+		}
+
+		if res != nil {
+			*results = append(*results, newCommandResult(label, res))
+		}
+		if err != nil {
+			diags.AddError(summary+" failed", commandFailureDetail(err, res, allowed))
+			return
+		}
+		if !exitCodeAllowed(res.ExitCode, allowed) {
+			diags.AddError(fmt.Sprintf("%s exited with code %d", summary, res.ExitCode),
+				commandFailureDetail(nil, res, allowed))
+			return
+		}
+		tflog.Debug(ctx, fmt.Sprintf("Script %d output: %s", i+1, truncate(res.Stdout, 500)))
+		cp.mark(ctx, key)
+	}
+}
+
+// hashScripts writes the content, interpreter, arguments and environment of
+// each script into h.
+func hashScripts(ctx context.Context, h io.Writer, scripts []ScriptBlock, d *planDigests) {
+	for _, s := range scripts {
+		if err := d.hashFile(h, s.Source.ValueString()); err != nil {
+			io.WriteString(h, s.Source.ValueString())
+		}
+		io.WriteString(h, s.label(ctx))
+		h.Write([]byte{0})
+		env := stringMap(ctx, s.Env)
+		for _, k := range sortedKeys(env) {
+			fmt.Fprintf(h, "%s=%s\x00", k, env[k])
+		}
+		if !s.AllowedExitCodes.IsNull() {
+			for _, c := range allowedExitCodes(ctx, s.AllowedExitCodes) {
+				fmt.Fprintf(h, "exit:%d", c)
+			}
+		}
+	}
+}
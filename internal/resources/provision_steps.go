@@ -0,0 +1,375 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"golang.org/x/crypto/argon2"
+
+	"github.com/hdresearch/vers-tf/internal/client"
+)
+
+const (
+	defaultStepTimeout    = 10 * time.Minute
+	defaultStepRetryDelay = 5 * time.Second
+	defaultRebootTimeout  = 5 * time.Minute
+)
+
+// envNamePattern matches valid shell environment variable names.
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// StepBlock is a structured provisioning step.
+type StepBlock struct {
+	Name             types.String `tfsdk:"name"`
+	Command          types.String `tfsdk:"command"`
+	Script           types.String `tfsdk:"script"`
+	Env              types.Map    `tfsdk:"env"`
+	SensitiveEnv     types.Map    `tfsdk:"sensitive_env"`
+	WorkingDir       types.String `tfsdk:"working_dir"`
+	Timeout          types.String `tfsdk:"timeout"`
+	Retries          types.Int64  `tfsdk:"retries"`
+	RetryDelay       types.String `tfsdk:"retry_delay"`
+	OnlyIf           types.String `tfsdk:"only_if"`
+	Unless           types.String `tfsdk:"unless"`
+	AllowedExitCodes types.List   `tfsdk:"allowed_exit_codes"`
+	Reboot           types.Bool   `tfsdk:"reboot"`
+}
+
+// stepSchemaAttributes returns the attributes of a 'steps' element.
+func stepSchemaAttributes() map[string]schema.Attribute {
+	return map[string]schema.Attribute{
+		"name": schema.StringAttribute{
+			Optional:    true,
+			Description: "Label for the step, used in logs, diagnostics and 'results'.",
+		},
+		"command": schema.StringAttribute{
+			Optional:    true,
+			Description: "Shell command to run. Exactly one of 'command', 'script' or 'reboot' must be set.",
+		},
+		"script": schema.StringAttribute{
+			Optional:    true,
+			Description: "Inline multi-line script to run with the login shell. Exactly one of 'command', 'script' or 'reboot' must be set.",
+		},
+		"env": schema.MapAttribute{
+			Optional:    true,
+			ElementType: types.StringType,
+			Description: "Environment variables for the step.",
+		},
+		"sensitive_env": schema.MapAttribute{
+			Optional:    true,
+			Sensitive:   true,
+			ElementType: types.StringType,
+			Description: "Environment variables with secret values. Like 'env', they are sent over the SSH session's stdin, " +
+				"so they never appear on a command line, in logs or in 'results'. " +
+				"A change still re-runs the provisioner: 'id' covers the names and a slow one-way digest of the values.",
+		},
+		"working_dir": schema.StringAttribute{
+			Optional:    true,
+			Description: "Directory to run the step (and its guards) in.",
+		},
+		"timeout": schema.StringAttribute{
+			Optional:    true,
+			Description: "Maximum duration of each attempt, e.g. \"30s\" or \"1h\". The remote process group is killed when it expires. Default: \"10m\".",
+		},
+		"retries": schema.Int64Attribute{
+			Optional:    true,
+			Description: "Number of times to retry the step after a failure. Default: 0.",
+		},
+		"retry_delay": schema.StringAttribute{
+			Optional:    true,
+			Description: "Delay before the first retry, doubled after each further failure. Default: \"5s\".",
+		},
+		"only_if": schema.StringAttribute{
+			Optional:    true,
+			Description: "Guard command; the step runs only if it exits 0.",
+		},
+		"unless": schema.StringAttribute{
+			Optional:    true,
+			Description: "Guard command; the step is skipped if it exits 0.",
+		},
+		"allowed_exit_codes": schema.ListAttribute{
+			Optional:    true,
+			ElementType: types.Int64Type,
+			Description: "Exit codes that count as success. Default: [0].",
+		},
+		"reboot": schema.BoolAttribute{
+			Optional: true,
+			Description: "Reboot the VM instead of running a command: sync, reboot, wait for the VM to go down and come back, " +
+				"then continue with the next step. 'timeout' bounds the whole reboot (default: \"5m\").",
+		},
+	}
+}
+
+// label returns a short description of the step for logs and diagnostics.
+func (s StepBlock) label(i int) string {
+	if !s.Name.IsNull() && s.Name.ValueString() != "" {
+		return s.Name.ValueString()
+	}
+	if !s.Command.IsNull() {
+		return truncate(s.Command.ValueString(), 80)
+	}
+	if s.Reboot.ValueBool() {
+		return "reboot"
+	}
+	return fmt.Sprintf("script %d", i+1)
+}
+
+// runSteps executes the structured steps in order, appending a result for
+// every step that ran. It stops at the first step that fails after retries.
+func runSteps(ctx context.Context, ssh *client.SSHClient, steps []StepBlock, cp *checkpoints, results *[]CommandResult, diags *diag.Diagnostics) {
+	for i, step := range steps {
+		label := step.label(i)
+		summary := fmt.Sprintf("Step %d (%s)", i+1, label)
+
+		key := cp.next(func(w io.Writer) { hashSteps(ctx, w, []StepBlock{step}) })
+		if cp.completed(key) {
+			tflog.Info(ctx, fmt.Sprintf("Skipping step %d/%d (%s): completed in an earlier apply", i+1, len(steps), label))
+			continue
+		}
+
+		defaultTimeout := defaultStepTimeout
+		if step.Reboot.ValueBool() {
+			defaultTimeout = defaultRebootTimeout
+		}
+		timeout, err := durationOrDefault(step.Timeout, defaultTimeout)
+		if err != nil {
+			diags.AddError(summary+": invalid timeout", err.Error())
+			return
+		}
+		delay, err := durationOrDefault(step.RetryDelay, defaultStepRetryDelay)
+		if err != nil {
+			diags.AddError(summary+": invalid retry_delay", err.Error())
+			return
+		}
+		preamble, err := stepPreamble(ctx, step)
+		if err != nil {
+			diags.AddError(summary+": invalid environment", err.Error())
+			return
+		}
+
+		var body string
+		switch {
+		case stepKinds(step) != 1:
+			diags.AddError(summary+": invalid step", "Each step requires exactly one of 'command', 'script' or 'reboot'.")
+			return
+		case !step.Command.IsNull():
+			body = step.Command.ValueString()
+		case !step.Script.IsNull():
+			body = step.Script.ValueString()
+		}
+
+		// Guards
+		if run, err := stepGuardsPass(ctx, ssh, step, preamble); err != nil {
+			diags.AddError(summary+": guard command failed", err.Error())
+			return
+		} else if !run {
+			tflog.Info(ctx, fmt.Sprintf("Skipping step %d/%d (%s): guard not satisfied", i+1, len(steps), label))
+			cp.mark(ctx, key)
+			continue
+		}
+
+		if step.Reboot.ValueBool() {
+			tflog.Info(ctx, fmt.Sprintf("Rebooting VM (step %d/%d)", i+1, len(steps)))
+			start := time.Now()
+			if err := ssh.Reboot(ctx, timeout); err != nil {
+				diags.AddError(summary+" failed", err.Error())
+				return
+			}
+			result := newCommandResult("reboot", &client.ExecResult{Duration: time.Since(start)})
+			result.Name = step.Name
+			*results = append(*results, result)
+			cp.mark(ctx, key)
+			continue
+		}
+
+		allowed := allowedExitCodes(ctx, step.AllowedExitCodes)
+		attempts := int(step.Retries.ValueInt64()) + 1
+		for attempt := 1; ; attempt++ {
+			tflog.Info(ctx, fmt.Sprintf("Running step %d/%d (%s), attempt %d/%d", i+1, len(steps), label, attempt, attempts))
+			res, err := runScript(ctx, ssh, preamble, body, timeout)
+			ok := err == nil && exitCodeAllowed(res.ExitCode, allowed)
+
+			if ok || attempt >= attempts || ctx.Err() != nil {
+				if res != nil {
+					result := newCommandResult(label, res)
+					result.Name = step.Name
+					*results = append(*results, result)
+				}
+				if err != nil {
+					diags.AddError(summary+" failed", commandFailureDetail(err, res, allowed))
+					return
+				}
+				if !ok {
+					diags.AddError(fmt.Sprintf("%s exited with code %d", summary, res.ExitCode),
+						commandFailureDetail(nil, res, allowed))
+					return
+				}
+				tflog.Debug(ctx, fmt.Sprintf("Step %d output: %s", i+1, truncate(res.Stdout, 500)))
+				cp.mark(ctx, key)
+				break
+			}
+
+			tflog.Warn(ctx, fmt.Sprintf("Step %d (%s) failed, retrying in %s", i+1, label, delay))
+			select {
+			case <-ctx.Done():
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+	}
+}
+
+// stepGuardsPass evaluates only_if and unless.
+func stepGuardsPass(ctx context.Context, ssh *client.SSHClient, step StepBlock, preamble string) (bool, error) {
+	if !step.OnlyIf.IsNull() {
+		res, err := runScript(ctx, ssh, preamble, step.OnlyIf.ValueString(), defaultStepTimeout)
+		if err != nil {
+			return false, fmt.Errorf("only_if: %w", err)
+		}
+		if res.ExitCode != 0 {
+			return false, nil
+		}
+	}
+	if !step.Unless.IsNull() {
+		res, err := runScript(ctx, ssh, preamble, step.Unless.ValueString(), defaultStepTimeout)
+		if err != nil {
+			return false, fmt.Errorf("unless: %w", err)
+		}
+		if res.ExitCode == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// runScript runs body under the login shell with the preamble (environment
+// and working directory) prepended. The script travels over stdin, so
+// neither it nor its environment shows up in the remote process list. It is
+// wrapped in braces so the shell parses it completely before running it,
+// leaving the commands' own stdin at EOF.
+func runScript(ctx context.Context, ssh *client.SSHClient, preamble, body string, timeout time.Duration) (*client.ExecResult, error) {
+	script := "{\n" + preamble + body + "\n}\n"
+	return runCommand(ctx, ssh, `exec "${SHELL:-sh}" -s`, strings.NewReader(script), timeout)
+}
+
+// stepPreamble renders the exports and cd that precede a step's body.
+func stepPreamble(ctx context.Context, step StepBlock) (string, error) {
+	env := stringMap(ctx, step.Env)
+	for k, v := range stringMap(ctx, step.SensitiveEnv) {
+		env[k] = v
+	}
+
+	preamble, err := envPreamble(env)
+	if err != nil {
+		return "", err
+	}
+	if !step.WorkingDir.IsNull() && step.WorkingDir.ValueString() != "" {
+		preamble += fmt.Sprintf("cd '%s' || exit 1\n", client.ShellEscape(step.WorkingDir.ValueString()))
+	}
+	return preamble, nil
+}
+
+// envPreamble renders env as export statements, in a stable order.
+func envPreamble(env map[string]string) (string, error) {
+	var b strings.Builder
+	for _, k := range sortedKeys(env) {
+		if !envNamePattern.MatchString(k) {
+			return "", fmt.Errorf("%q is not a valid environment variable name", k)
+		}
+		fmt.Fprintf(&b, "export %s='%s'\n", k, client.ShellEscape(env[k]))
+	}
+	return b.String(), nil
+}
+
+// hashSteps writes every field of the steps into h, in a stable order.
+func hashSteps(ctx context.Context, h io.Writer, steps []StepBlock) {
+	for _, s := range steps {
+		for _, v := range []types.String{s.Name, s.Command, s.Script, s.WorkingDir, s.Timeout, s.RetryDelay, s.OnlyIf, s.Unless} {
+			io.WriteString(h, v.ValueString())
+			h.Write([]byte{0})
+		}
+		fmt.Fprintf(h, "%d", s.Retries.ValueInt64())
+		env := stringMap(ctx, s.Env)
+		for _, k := range sortedKeys(env) {
+			fmt.Fprintf(h, "%s=%s\x00", k, env[k])
+		}
+		secrets := stringMap(ctx, s.SensitiveEnv)
+		for _, k := range sortedKeys(secrets) {
+			fmt.Fprintf(h, "%s~%x\x00", k, secretMarker(k, secrets[k]))
+		}
+		if !s.AllowedExitCodes.IsNull() {
+			for _, c := range allowedExitCodes(ctx, s.AllowedExitCodes) {
+				fmt.Fprintf(h, "exit:%d", c)
+			}
+		}
+		if s.Reboot.ValueBool() {
+			io.WriteString(h, "reboot")
+		}
+	}
+}
+
+// secretMarker derives a change marker for a sensitive_env value. The ID is
+// in plain state and plan output, so it must not allow guessing the value
+// with a fast hash: argon2id makes every guess cost tens of milliseconds.
+func secretMarker(name, value string) []byte {
+	return argon2.IDKey([]byte(value), []byte("vers-tf/sensitive_env/"+name), 2, 19*1024, 1, 16)
+}
+
+// stepKinds counts how many of command, script and reboot a step sets.
+// Unknown values count as set.
+func stepKinds(s StepBlock) int {
+	n := 0
+	if !s.Command.IsNull() {
+		n++
+	}
+	if !s.Script.IsNull() {
+		n++
+	}
+	if s.Reboot.IsUnknown() || s.Reboot.ValueBool() {
+		n++
+	}
+	return n
+}
+
+// durationOrDefault parses an optional duration string.
+func durationOrDefault(v types.String, def time.Duration) (time.Duration, error) {
+	if v.IsNull() || v.IsUnknown() || v.ValueString() == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v.ValueString())
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("duration must be positive, got %s", v.ValueString())
+	}
+	return d, nil
+}
+
+// stringMap converts a map of strings, returning an empty map when it is null or unknown.
+func stringMap(ctx context.Context, m types.Map) map[string]string {
+	out := map[string]string{}
+	if m.IsNull() || m.IsUnknown() {
+		return out
+	}
+	m.ElementsAs(ctx, &out, false)
+	return out
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
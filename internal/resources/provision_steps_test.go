@@ -0,0 +1,37 @@
+package resources
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+func TestDurationOrDefault(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       types.String
+		want    time.Duration
+		wantErr bool
+	}{
+		{"null", types.StringNull(), time.Minute, false},
+		{"unknown", types.StringUnknown(), time.Minute, false},
+		{"empty", types.StringValue(""), time.Minute, false},
+		{"seconds", types.StringValue("30s"), 30 * time.Second, false},
+		{"compound", types.StringValue("1h30m"), 90 * time.Minute, false},
+		{"zero", types.StringValue("0s"), 0, true},
+		{"negative", types.StringValue("-5s"), 0, true},
+		{"no unit", types.StringValue("30"), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := durationOrDefault(tt.v, time.Minute)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+
+	"github.com/hdresearch/vers-tf/internal/client"
+)
+
+// SyncBlock mirrors a local directory to the VM, uploading only what changed.
+type SyncBlock struct {
+	Source      types.String `tfsdk:"source"`
+	Destination types.String `tfsdk:"destination"`
+	Delete      types.Bool   `tfsdk:"delete"`
+	Include     types.List   `tfsdk:"include"`
+	Exclude     types.List   `tfsdk:"exclude"`
+	Mode        types.String `tfsdk:"mode"`
+	Owner       types.String `tfsdk:"owner"`
+	Group       types.String `tfsdk:"group"`
+}
+
+// syncSchemaAttributes returns the attributes of a 'sync' block.
+func syncSchemaAttributes() map[string]schema.Attribute {
+	return map[string]schema.Attribute{
+		"source": schema.StringAttribute{
+			Required:    true,
+			Description: "Local directory to mirror.",
+		},
+		"destination": schema.StringAttribute{
+			Required:    true,
+			Description: "Absolute path of the directory on the VM.",
+		},
+		"delete": schema.BoolAttribute{
+			Optional:    true,
+			Description: "Delete files under 'destination' that do not exist locally. Files outside 'include'/'exclude' are never deleted. Default: false.",
+		},
+		"include": schema.ListAttribute{
+			Optional:    true,
+			ElementType: types.StringType,
+			Description: "Globs selecting the files to sync (default: all). '**' matches any number of directories.",
+		},
+		"exclude": schema.ListAttribute{
+			Optional:    true,
+			ElementType: types.StringType,
+			Description: "Globs of files or directories to leave alone, both locally and on the VM.",
+		},
+		"mode": schema.StringAttribute{
+			Optional:    true,
+			Description: "Octal permissions applied to every uploaded file. Default: the local file modes.",
+		},
+		"owner": schema.StringAttribute{
+			Optional:    true,
+			Description: "User that owns the uploaded files. Default: the login user.",
+		},
+		"group": schema.StringAttribute{
+			Optional:    true,
+			Description: "Group that owns the uploaded files. Default: the owner's primary group.",
+		},
+	}
+}
+
+// syncBlocks decodes the sync blocks, reporting false when the list itself is not known.
+func syncBlocks(ctx context.Context, plan ProvisionResourceModel) ([]SyncBlock, bool) {
+	if plan.Sync.IsNull() || plan.Sync.IsUnknown() {
+		return nil, false
+	}
+	var blocks []SyncBlock
+	if diags := plan.Sync.ElementsAs(ctx, &blocks, false); diags.HasError() {
+		return nil, false
+	}
+	return blocks, true
+}
+
+func syncOptions(ctx context.Context, b SyncBlock) client.SyncOptions {
+	return client.SyncOptions{
+		Include: stringList(ctx, b.Include),
+		Exclude: stringList(ctx, b.Exclude),
+		Delete:  b.Delete.ValueBool(),
+		Attrs: client.FileAttrs{
+			Mode:  b.Mode.ValueString(),
+			Owner: b.Owner.ValueString(),
+			Group: b.Group.ValueString(),
+		},
+	}
+}
+
+// runSyncs brings every sync destination up to date with its local source.
+func runSyncs(ctx context.Context, ssh *client.SSHClient, blocks []SyncBlock, diags *diag.Diagnostics) {
+	for i, b := range blocks {
+		src, dest := b.Source.ValueString(), b.Destination.ValueString()
+		tflog.Info(ctx, fmt.Sprintf("Syncing %s -> %s", src, dest))
+		res, err := ssh.SyncDir(ctx, src, dest, syncOptions(ctx, b))
+		if err != nil {
+			diags.AddError(fmt.Sprintf("Failed to sync %s to %s (sync %d)", src, dest, i+1), err.Error())
+			return
+		}
+		tflog.Info(ctx, fmt.Sprintf("Synced %s: %d file(s) uploaded, %d deleted", dest, len(res.Uploaded), len(res.Deleted)))
+	}
+}
+
+// syncChanged reports whether the sync blocks or their contents differ
+// between plan and state.
+func syncChanged(plan, state ProvisionResourceModel) bool {
+	return !plan.Sync.Equal(state.Sync) || !plan.SyncHashes.Equal(state.SyncHashes)
+}
+
+// syncNow runs the sync blocks on their own, for an update where nothing
+// else changed.
+func (r *ProvisionResource) syncNow(ctx context.Context, plan ProvisionResourceModel, diags *diag.Diagnostics) {
+	blocks, ok := syncBlocks(ctx, plan)
+	if !ok {
+		return
+	}
+
+	ssh, err := r.client.ConnectSSH(plan.VMID.ValueString())
+	if err != nil {
+		diags.AddError("Failed to create SSH client", err.Error())
+		return
+	}
+	defer ssh.Cleanup()
+
+	if err := ssh.WaitReachable(ctx, 3*time.Minute); err != nil {
+		diags.AddError("VM not reachable via SSH", err.Error())
+		return
+	}
+
+	runSyncs(ctx, ssh, blocks, diags)
+	if diags.HasError() {
+		return
+	}
+	if _, err := ssh.ExecWithTimeout(ctx, "sync", 2*time.Minute); err != nil {
+		diags.AddError("Failed to sync filesystem after provisioning",
+			fmt.Sprintf("The 'sync' command failed: %s. A subsequent commit may produce a corrupt image.", err.Error()))
+	}
+}
+
+// expectedSyncHashes returns the digest every synced file should have on the
+// VM, keyed by remote path: the SHA-256 of a regular file, or
+// "symlink:<target>" for a symlink.
+func expectedSyncHashes(ctx context.Context, plan ProvisionResourceModel) (map[string]string, bool) {
+	blocks, ok := syncBlocks(ctx, plan)
+	if !ok {
+		return nil, false
+	}
+
+	out := map[string]string{}
+	for _, b := range blocks {
+		if !known(b.Source) || !known(b.Destination) || b.Include.IsUnknown() || b.Exclude.IsUnknown() {
+			return nil, false
+		}
+		root := b.Source.ValueString()
+		files, err := client.ListTree(root, stringList(ctx, b.Include), stringList(ctx, b.Exclude))
+		if err != nil {
+			return nil, false
+		}
+		manifest, err := client.LocalManifest(root, files)
+		if err != nil {
+			return nil, false
+		}
+		for rel, e := range manifest {
+			out[path.Join(b.Destination.ValueString(), rel)] = e.Digest()
+		}
+	}
+	return out, true
+}
+
+// syncHashesValue computes sync_hashes at apply time. It is null without
+// sync blocks.
+func syncHashesValue(ctx context.Context, plan ProvisionResourceModel, diags *diag.Diagnostics) types.Map {
+	if plan.Sync.IsNull() {
+		return types.MapNull(types.StringType)
+	}
+	m, ok := expectedSyncHashes(ctx, plan)
+	if !ok {
+		diags.AddError("Failed to hash synced files", "A local 'sync' source could not be read.")
+		return types.MapNull(types.StringType)
+	}
+	return contentHashValue(ctx, m, diags)
+}
+
+// refreshSyncHashes replaces state.SyncHashes with what is on the VM now:
+// the files synced earlier and, with 'delete', any other file the next sync
+// would remove. SSH errors are reported as warnings so a refresh still
+// succeeds while the VM is unreachable.
+func (r *ProvisionResource) refreshSyncHashes(ctx context.Context, state *ProvisionResourceModel, diags *diag.Diagnostics) {
+	blocks, ok := syncBlocks(ctx, *state)
+	if !ok {
+		return
+	}
+	recorded := stringMap(ctx, state.SyncHashes)
+
+	ssh, err := r.client.ConnectSSH(state.VMID.ValueString())
+	if err != nil {
+		diags.AddWarning("Skipped sync refresh", fmt.Sprintf("Could not create SSH client: %s", err))
+		return
+	}
+	defer ssh.Cleanup()
+
+	current := map[string]string{}
+	for _, b := range blocks {
+		dest := b.Destination.ValueString()
+		queryCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+		remote, err := ssh.RemoteManifest(queryCtx, dest)
+		cancel()
+		if err != nil {
+			diags.AddWarning("Skipped sync refresh", fmt.Sprintf("Could not list %s on the VM: %s", dest, err))
+			return
+		}
+
+		include, exclude := stringList(ctx, b.Include), stringList(ctx, b.Exclude)
+		for rel, e := range remote {
+			p := path.Join(dest, rel)
+			if !client.Selected(rel, include, exclude) {
+				continue
+			}
+			if _, tracked := recorded[p]; tracked || b.Delete.ValueBool() {
+				current[p] = e.Digest()
+			}
+		}
+	}
+	state.SyncHashes = contentHashValue(ctx, current, diags)
+}
+
+// syncDestinationConflict returns a description of the first sync
+// destination that repeats or is nested in another, or "".
+func syncDestinationConflict(blocks []SyncBlock) string {
+	for i, a := range blocks {
+		for _, b := range blocks[i+1:] {
+			if !known(a.Destination) || !known(b.Destination) {
+				continue
+			}
+			x := strings.TrimSuffix(path.Clean(a.Destination.ValueString()), "/") + "/"
+			y := strings.TrimSuffix(path.Clean(b.Destination.ValueString()), "/") + "/"
+			if strings.HasPrefix(x, y) || strings.HasPrefix(y, x) {
+				return fmt.Sprintf("%q and %q overlap.", a.Destination.ValueString(), b.Destination.ValueString())
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,125 @@
+package resources
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+)
+
+// testFileBlock builds a files element with every attribute null except
+// those in set.
+func testFileBlock(t *testing.T, set map[string]attr.Value) attr.Value {
+	t.Helper()
+	ctx := context.Background()
+	elem := fileBlockType(t)
+	vals := map[string]attr.Value{}
+	for k, ty := range elem.AttrTypes {
+		v, err := ty.ValueFromTerraform(ctx, tftypes.NewValue(ty.TerraformType(ctx), nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		vals[k] = v
+	}
+	for k, v := range set {
+		vals[k] = v
+	}
+	o, diags := types.ObjectValue(elem.AttrTypes, vals)
+	if diags.HasError() {
+		t.Fatal(diags)
+	}
+	return o
+}
+
+func fileBlockType(t *testing.T) types.ObjectType {
+	t.Helper()
+	var resp resource.SchemaResponse
+	(&ProvisionResource{}).Schema(context.Background(), resource.SchemaRequest{}, &resp)
+	return resp.Schema.Attributes["files"].GetType().(types.ListType).ElemType.(types.ObjectType)
+}
+
+func TestDigestPlanID(t *testing.T) {
+	ctx := context.Background()
+	src := filepath.Join(t.TempDir(), "src.txt")
+	if err := os.WriteFile(src, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	commands, _ := types.ListValueFrom(ctx, types.StringType, []string{"echo hi"})
+
+	// legacy is the ID of the plan below as computed before file blocks
+	// had mode, owner and group: sha256 over VM ID, each destination with
+	// its content, then the commands.
+	sum := sha256.Sum256([]byte("vm1/ahello/binlineecho hi"))
+	legacy := hex.EncodeToString(sum[:])[:16]
+
+	tests := []struct {
+		name     string
+		extra    map[string]attr.Value
+		wantSame bool
+	}{
+		{"no attributes", nil, true},
+		{"mode", map[string]attr.Value{"mode": types.StringValue("0600")}, false},
+		{"owner", map[string]attr.Value{"owner": types.StringValue("app")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := map[string]attr.Value{"destination": types.StringValue("/a"), "source": types.StringValue(src)}
+			for k, v := range tt.extra {
+				set[k] = v
+			}
+			files, diags := types.ListValue(fileBlockType(t), []attr.Value{
+				testFileBlock(t, set),
+				testFileBlock(t, map[string]attr.Value{"destination": types.StringValue("/b"), "content": types.StringValue("inline")}),
+			})
+			if diags.HasError() {
+				t.Fatal(diags)
+			}
+			plan := ProvisionResourceModel{VMID: types.StringValue("vm1"), Files: files, Commands: commands}
+
+			r := &ProvisionResource{}
+			id := r.digestPlan(ctx, plan).id
+			if again := r.digestPlan(ctx, plan).id; again != id {
+				t.Fatalf("ID not stable: %s, then %s", id, again)
+			}
+			if (id == legacy) != tt.wantSame {
+				t.Errorf("ID = %s, legacy ID = %s, want same: %v", id, legacy, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestCommandExitCodes(t *testing.T) {
+	ctx := context.Background()
+	codes, diags := types.MapValueFrom(ctx, types.ListType{ElemType: types.Int64Type}, map[string][]int64{"1": {0, 1}, "2": {3}})
+	if diags.HasError() {
+		t.Fatal(diags)
+	}
+
+	tests := []struct {
+		name  string
+		codes types.Map
+		index int
+		want  []int64
+	}{
+		{"null map", types.MapNull(types.ListType{ElemType: types.Int64Type}), 1, []int64{0}},
+		{"unknown map", types.MapUnknown(types.ListType{ElemType: types.Int64Type}), 1, []int64{0}},
+		{"no entry", codes, 0, []int64{0}},
+		{"entry", codes, 1, []int64{0, 1}},
+		{"entry without 0", codes, 2, []int64{3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := commandExitCodes(ctx, tt.codes, tt.index); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("commandExitCodes(%d) = %v, want %v", tt.index, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package resources
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	pathpkg "path"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-framework/types/basetypes"
+
+	"github.com/hdresearch/vers-tf/internal/client"
+)
+
+var (
+	_ resource.ResourceWithConfigValidators = &ProvisionResource{}
+	_ resource.ResourceWithValidateConfig   = &ProvisionResource{}
+)
+
+// ConfigValidators enforces the structural rules of vers_provision blocks.
+func (r *ProvisionResource) ConfigValidators(_ context.Context) []resource.ConfigValidator {
+	return []resource.ConfigValidator{
+		fileSourceValidator{},
+		fileDestinationValidator{},
+		stepCommandValidator{},
+	}
+}
+
+// ValidateConfig checks values that can only be verified against the local
+// machine or by parsing them: that sources exist, that sync destinations do
+// not overlap, and that modes, base64 content, durations and environment
+// names are well-formed. Unknown values are skipped and checked again at
+// apply time.
+func (r *ProvisionResource) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var config ProvisionResourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &config)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if files, ok := configFiles(ctx, config); ok {
+		for i, f := range files {
+			p := path.Root("files").AtListIndex(i)
+			if known(f.Source) {
+				if err := checkLocalFile(f.Source.ValueString()); err != nil {
+					resp.Diagnostics.AddAttributeError(p.AtName("source"), "Invalid source", err.Error())
+				}
+			}
+			if known(f.SourceDir) {
+				if info, err := os.Stat(f.SourceDir.ValueString()); err != nil {
+					resp.Diagnostics.AddAttributeError(p.AtName("source_dir"), "Invalid source_dir", err.Error())
+				} else if !info.IsDir() {
+					resp.Diagnostics.AddAttributeError(p.AtName("source_dir"), "Invalid source_dir",
+						fmt.Sprintf("%s is not a directory.", f.SourceDir.ValueString()))
+				}
+			} else if !f.SourceDir.IsUnknown() && (!f.Include.IsNull() || !f.Exclude.IsNull()) {
+				resp.Diagnostics.AddAttributeError(p, "Invalid file block", "'include' and 'exclude' only apply to 'source_dir'.")
+			}
+			if known(f.Archive) {
+				if _, err := client.ArchiveFormat(f.Archive.ValueString()); err != nil {
+					resp.Diagnostics.AddAttributeError(p.AtName("archive"), "Invalid archive", err.Error())
+				}
+				if !f.Mode.IsNull() {
+					resp.Diagnostics.AddAttributeError(p.AtName("mode"), "Invalid file block",
+						"'mode' is not supported for 'archive'; file modes come from the archive.")
+				}
+				if f.CleanDestination.ValueBool() && known(f.Destination) && pathpkg.Clean("/"+f.Destination.ValueString()) == "/" {
+					resp.Diagnostics.AddAttributeError(p.AtName("clean_destination"), "Invalid file block",
+						"'clean_destination' cannot be used with destination \"/\".")
+				}
+			} else if !f.Archive.IsUnknown() && (!f.StripComponents.IsNull() || !f.CleanDestination.IsNull()) {
+				resp.Diagnostics.AddAttributeError(p, "Invalid file block", "'strip_components' and 'clean_destination' only apply to 'archive'.")
+			}
+			if !f.StripComponents.IsNull() && !f.StripComponents.IsUnknown() && f.StripComponents.ValueInt64() < 0 {
+				resp.Diagnostics.AddAttributeError(p.AtName("strip_components"), "Invalid strip_components", "'strip_components' must not be negative.")
+			}
+			if known(f.ContentBase64) {
+				if _, err := base64.StdEncoding.DecodeString(f.ContentBase64.ValueString()); err != nil {
+					resp.Diagnostics.AddAttributeError(p.AtName("content_base64"), "Invalid content_base64", err.Error())
+				}
+			}
+			if known(f.Mode) {
+				if _, err := client.ParseMode(f.Mode.ValueString()); err != nil {
+					resp.Diagnostics.AddAttributeError(p.AtName("mode"), "Invalid mode", err.Error())
+				}
+			}
+		}
+	}
+
+	if blocks, ok := syncBlocks(ctx, config); ok {
+		for i, b := range blocks {
+			p := path.Root("sync").AtListIndex(i)
+			if known(b.Source) {
+				if info, err := os.Stat(b.Source.ValueString()); err != nil {
+					resp.Diagnostics.AddAttributeError(p.AtName("source"), "Invalid sync source", err.Error())
+				} else if !info.IsDir() {
+					resp.Diagnostics.AddAttributeError(p.AtName("source"), "Invalid sync source",
+						fmt.Sprintf("%s is not a directory.", b.Source.ValueString()))
+				}
+			}
+			if known(b.Destination) {
+				dest := b.Destination.ValueString()
+				if !strings.HasPrefix(dest, "/") {
+					resp.Diagnostics.AddAttributeError(p.AtName("destination"), "Invalid destination",
+						fmt.Sprintf("%q is not an absolute path.", dest))
+				} else if pathpkg.Clean(dest) == "/" && b.Delete.ValueBool() {
+					resp.Diagnostics.AddAttributeError(p.AtName("delete"), "Invalid sync block",
+						"'delete' cannot be used with destination \"/\".")
+				}
+			}
+			if known(b.Mode) {
+				if _, err := client.ParseMode(b.Mode.ValueString()); err != nil {
+					resp.Diagnostics.AddAttributeError(p.AtName("mode"), "Invalid mode", err.Error())
+				}
+			}
+		}
+		if msg := syncDestinationConflict(blocks); msg != "" {
+			resp.Diagnostics.AddAttributeError(path.Root("sync"), "Overlapping sync destinations",
+				msg+" Each sync destination must be a separate directory.")
+		}
+	}
+
+	if !config.Scripts.IsNull() && !config.Scripts.IsUnknown() {
+		var scripts []ScriptBlock
+		resp.Diagnostics.Append(config.Scripts.ElementsAs(ctx, &scripts, false)...)
+		for i, s := range scripts {
+			p := path.Root("scripts").AtListIndex(i)
+			if known(s.Source) {
+				if err := checkLocalFile(s.Source.ValueString()); err != nil {
+					resp.Diagnostics.AddAttributeError(p.AtName("source"), "Invalid script source", err.Error())
+				}
+			}
+			checkEnvNames(ctx, s.Env, p.AtName("env"), resp)
+		}
+	}
+
+	if !config.AllowedExitCodes.IsNull() && !config.AllowedExitCodes.IsUnknown() {
+		n := -1 // number of commands, if known
+		if !config.Commands.IsUnknown() {
+			n = len(config.Commands.Elements())
+		}
+		for k := range config.AllowedExitCodes.Elements() {
+			i, err := strconv.Atoi(k)
+			switch {
+			case err != nil || i < 0 || strconv.Itoa(i) != k:
+				resp.Diagnostics.AddAttributeError(path.Root("allowed_exit_codes").AtMapKey(k), "Invalid allowed_exit_codes key",
+					fmt.Sprintf("%q is not a command index; keys are positions in 'commands', starting at \"0\".", k))
+			case n >= 0 && i >= n:
+				resp.Diagnostics.AddAttributeError(path.Root("allowed_exit_codes").AtMapKey(k), "Invalid allowed_exit_codes key",
+					fmt.Sprintf("There is no command %s; 'commands' has %d entries.", k, n))
+			}
+		}
+	}
+
+	if !config.OnDestroy.IsNull() && !config.OnDestroy.IsUnknown() {
+		var od OnDestroyBlock
+		resp.Diagnostics.Append(config.OnDestroy.As(ctx, &od, basetypes.ObjectAsOptions{})...)
+		p := path.Root("on_destroy")
+		if known(od.OnFailure) && od.OnFailure.ValueString() != onFailureFail && od.OnFailure.ValueString() != onFailureContinue {
+			resp.Diagnostics.AddAttributeError(p.AtName("on_failure"), "Invalid on_failure",
+				fmt.Sprintf("Expected %q or %q, got %q.", onFailureFail, onFailureContinue, od.OnFailure.ValueString()))
+		}
+		for i, f := range stringList(ctx, od.RemoveFiles) {
+			if !strings.HasPrefix(f, "/") {
+				resp.Diagnostics.AddAttributeError(p.AtName("remove_files").AtListIndex(i), "Invalid path",
+					fmt.Sprintf("%q is not an absolute path.", f))
+			}
+		}
+	}
+
+	if !config.Steps.IsNull() && !config.Steps.IsUnknown() {
+		var steps []StepBlock
+		resp.Diagnostics.Append(config.Steps.ElementsAs(ctx, &steps, false)...)
+		for i, s := range steps {
+			p := path.Root("steps").AtListIndex(i)
+			for name, v := range map[string]types.String{"timeout": s.Timeout, "retry_delay": s.RetryDelay} {
+				if _, err := durationOrDefault(v, 0); err != nil {
+					resp.Diagnostics.AddAttributeError(p.AtName(name), "Invalid "+name, err.Error())
+				}
+			}
+			if !s.Retries.IsNull() && !s.Retries.IsUnknown() && s.Retries.ValueInt64() < 0 {
+				resp.Diagnostics.AddAttributeError(p.AtName("retries"), "Invalid retries", "'retries' must not be negative.")
+			}
+			checkEnvNames(ctx, s.Env, p.AtName("env"), resp)
+			checkEnvNames(ctx, s.SensitiveEnv, p.AtName("sensitive_env"), resp)
+		}
+	}
+}
+
+// fileSourceValidator requires each file block to set exactly one content source.
+type fileSourceValidator struct{}
+
+func (v fileSourceValidator) Description(_ context.Context) string {
+	return "Each file block must set exactly one of 'source', 'source_dir', 'content', 'content_base64' or 'archive'."
+}
+
+func (v fileSourceValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v fileSourceValidator) ValidateResource(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var config ProvisionResourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &config)...)
+	files, ok := configFiles(ctx, config)
+	if resp.Diagnostics.HasError() || !ok {
+		return
+	}
+
+	for i, f := range files {
+		set := 0
+		for _, s := range []types.String{f.Source, f.SourceDir, f.Content, f.ContentBase64, f.Archive} {
+			if !s.IsNull() {
+				set++
+			}
+		}
+		if set != 1 {
+			resp.Diagnostics.AddAttributeError(path.Root("files").AtListIndex(i), "Invalid file block",
+				fmt.Sprintf("%s Got %d for destination %q.", v.Description(ctx), set, f.Destination.ValueString()))
+		}
+	}
+}
+
+// fileDestinationValidator requires absolute, unique destinations.
+type fileDestinationValidator struct{}
+
+func (v fileDestinationValidator) Description(_ context.Context) string {
+	return "File destinations must be absolute paths and must not repeat."
+}
+
+func (v fileDestinationValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v fileDestinationValidator) ValidateResource(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var config ProvisionResourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &config)...)
+	files, ok := configFiles(ctx, config)
+	if resp.Diagnostics.HasError() || !ok {
+		return
+	}
+
+	seen := map[string]int{}
+	for i, f := range files {
+		if !known(f.Destination) {
+			continue
+		}
+		p := path.Root("files").AtListIndex(i).AtName("destination")
+		dest := f.Destination.ValueString()
+		if !checkAbsolutePath(dest, p, "Invalid destination", resp) {
+			continue
+		}
+		key := strings.TrimSuffix(dest, "/")
+		if j, dup := seen[key]; dup {
+			resp.Diagnostics.AddAttributeError(p, "Duplicate destination",
+				fmt.Sprintf("%q is also the destination of file %d.", dest, j+1))
+			continue
+		}
+		seen[key] = i
+	}
+}
+
+// checkAbsolutePath reports a remote path that is not absolute, under
+// summary, and says whether it was.
+func checkAbsolutePath(remote string, p path.Path, summary string, resp *resource.ValidateConfigResponse) bool {
+	if strings.HasPrefix(remote, "/") {
+		return true
+	}
+	resp.Diagnostics.AddAttributeError(p, summary, fmt.Sprintf("%q is not an absolute path.", remote))
+	return false
+}
+
+// stepCommandValidator requires each step to set exactly one of command, script or reboot.
+type stepCommandValidator struct{}
+
+func (v stepCommandValidator) Description(_ context.Context) string {
+	return "Each step must set exactly one of 'command', 'script' or 'reboot = true'."
+}
+
+func (v stepCommandValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v stepCommandValidator) ValidateResource(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var config ProvisionResourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &config)...)
+	if resp.Diagnostics.HasError() || config.Steps.IsNull() || config.Steps.IsUnknown() {
+		return
+	}
+
+	var steps []StepBlock
+	resp.Diagnostics.Append(config.Steps.ElementsAs(ctx, &steps, false)...)
+	for i, s := range steps {
+		if stepKinds(s) != 1 {
+			resp.Diagnostics.AddAttributeError(path.Root("steps").AtListIndex(i), "Invalid step", v.Description(ctx))
+		}
+	}
+}
+
+// configFiles decodes the file blocks, reporting false when the list itself is not known.
+func configFiles(ctx context.Context, config ProvisionResourceModel) ([]FileBlock, bool) {
+	if config.Files.IsNull() || config.Files.IsUnknown() {
+		return nil, false
+	}
+	var files []FileBlock
+	if diags := config.Files.ElementsAs(ctx, &files, false); diags.HasError() {
+		return nil, false
+	}
+	return files, true
+}
+
+// checkLocalFile verifies that p exists and is not a directory.
+func checkLocalFile(p string) error {
+	info, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", p)
+	}
+	return nil
+}
+
+func checkEnvNames(ctx context.Context, env types.Map, p path.Path, resp *resource.ValidateConfigResponse) {
+	for k := range stringMap(ctx, env) {
+		if !envNamePattern.MatchString(k) {
+			resp.Diagnostics.AddAttributeError(p, "Invalid environment variable name",
+				fmt.Sprintf("%q is not a valid environment variable name.", k))
+		}
+	}
+}
+
+func known(v types.String) bool {
+	return !v.IsNull() && !v.IsUnknown()
+}
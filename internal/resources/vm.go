@@ -2,7 +2,6 @@ package resources
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
@@ -96,7 +95,7 @@ func (r *VMResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *r
 			},
 			"ssh_host": schema.StringAttribute{
 				Computed:    true,
-				Description: "SSH hostname for the VM ({id}.vm.vers.sh).",
+				Description: "SSH hostname for the VM ({id}.{vm_domain}, e.g. {id}.vm.vers.sh).",
 			},
 			"ssh_private_key": schema.StringAttribute{
 				Computed:    true,
@@ -151,7 +150,7 @@ func (r *VMResource) Create(ctx context.Context, req resource.CreateRequest, res
 	}
 
 	plan.ID = types.StringValue(result.VMID)
-	plan.SSHHost = types.StringValue(fmt.Sprintf("%s.vm.vers.sh", result.VMID))
+	plan.SSHHost = types.StringValue(r.client.VMHost(result.VMID))
 
 	// Fetch current state
 	vm, err := r.client.GetVM(result.VMID)
@@ -196,7 +195,7 @@ func (r *VMResource) Read(ctx context.Context, req resource.ReadRequest, resp *r
 
 	state.State = types.StringValue(vm.State)
 	state.CreatedAt = types.StringValue(vm.CreatedAt)
-	state.SSHHost = types.StringValue(fmt.Sprintf("%s.vm.vers.sh", vm.VMID))
+	state.SSHHost = types.StringValue(r.client.VMHost(vm.VMID))
 
 	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
 }
@@ -2,7 +2,6 @@ package resources
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
@@ -109,7 +108,7 @@ func (r *VMBranchResource) Create(ctx context.Context, req resource.CreateReques
 	}
 
 	plan.ID = types.StringValue(newVMID)
-	plan.SSHHost = types.StringValue(fmt.Sprintf("%s.vm.vers.sh", newVMID))
+	plan.SSHHost = types.StringValue(r.client.VMHost(newVMID))
 
 	// Fetch state
 	vm, err := r.client.GetVM(newVMID)
@@ -153,7 +152,7 @@ func (r *VMBranchResource) Read(ctx context.Context, req resource.ReadRequest, r
 
 	state.State = types.StringValue(vm.State)
 	state.CreatedAt = types.StringValue(vm.CreatedAt)
-	state.SSHHost = types.StringValue(fmt.Sprintf("%s.vm.vers.sh", vm.VMID))
+	state.SSHHost = types.StringValue(r.client.VMHost(vm.VMID))
 
 	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
 }
@@ -179,15 +179,7 @@ func (r *VMCommitResource) Delete(ctx context.Context, req resource.DeleteReques
 // In practice, every Terraform workflow that does provision → commit will
 // have the VM running and SSH-reachable.
 func (r *VMCommitResource) syncBeforeCommit(ctx context.Context, vmID string) {
-	sshKey, err := r.client.GetSSHKey(vmID)
-	if err != nil {
-		tflog.Warn(ctx, "Could not get SSH key for pre-commit sync (skipping)", map[string]interface{}{
-			"vm_id": vmID, "error": err.Error(),
-		})
-		return
-	}
-
-	ssh, err := client.NewSSHClient(vmID, sshKey.SSHPrivateKey)
+	ssh, err := r.client.ConnectSSH(vmID)
 	if err != nil {
 		tflog.Warn(ctx, "Could not create SSH client for pre-commit sync (skipping)", map[string]interface{}{
 			"vm_id": vmID, "error": err.Error(),
@@ -197,7 +189,7 @@ func (r *VMCommitResource) syncBeforeCommit(ctx context.Context, vmID string) {
 	defer ssh.Cleanup()
 
 	tflog.Debug(ctx, "Running 'sync' on VM before commit to flush dirty pages", map[string]interface{}{"vm_id": vmID})
-	if _, err := ssh.ExecWithTimeout("sync", 2*time.Minute); err != nil {
+	if _, err := ssh.ExecWithTimeout(ctx, "sync", 2*time.Minute); err != nil {
 		tflog.Warn(ctx, "Pre-commit sync failed (VM may not be SSH-reachable)", map[string]interface{}{
 			"vm_id": vmID, "error": err.Error(),
 		})
@@ -0,0 +1,326 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+
+	"github.com/hdresearch/vers-tf/internal/client"
+)
+
+var (
+	_ resource.Resource                   = &VMExecResource{}
+	_ resource.ResourceWithConfigure      = &VMExecResource{}
+	_ resource.ResourceWithModifyPlan     = &VMExecResource{}
+	_ resource.ResourceWithValidateConfig = &VMExecResource{}
+)
+
+const defaultExecTimeout = 5 * time.Minute
+
+// Events a vers_vm_exec command can run on.
+var execEvents = map[string]bool{"create": true, "update": true, "destroy": true}
+
+type VMExecResource struct {
+	client *client.Client
+}
+
+type VMExecResourceModel struct {
+	ID               types.String `tfsdk:"id"`
+	VMID             types.String `tfsdk:"vm_id"`
+	Command          types.String `tfsdk:"command"`
+	When             types.List   `tfsdk:"when"`
+	Triggers         types.Map    `tfsdk:"triggers"`
+	Timeout          types.String `tfsdk:"timeout"`
+	AllowedExitCodes types.List   `tfsdk:"allowed_exit_codes"`
+	Stdout           types.String `tfsdk:"stdout"`
+	Stderr           types.String `tfsdk:"stderr"`
+	ExitCode         types.Int64  `tfsdk:"exit_code"`
+}
+
+// runsOn reports whether the command runs on event. Without 'when' it runs
+// on create and update.
+func (m VMExecResourceModel) runsOn(ctx context.Context, event string) bool {
+	if m.When.IsNull() {
+		return event != "destroy"
+	}
+	for _, e := range stringList(ctx, m.When) {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func NewVMExecResource() resource.Resource {
+	return &VMExecResource{}
+}
+
+func (r *VMExecResource) Metadata(_ context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_vm_exec"
+}
+
+func (r *VMExecResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Run a command on a Vers VM when the resource is created, when its command or triggers change, " +
+			"or when it is destroyed. A lightweight alternative to vers_provision for one-off actions such as reloading a service or running migrations.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:    true,
+				Description: "Resource ID.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"vm_id": schema.StringAttribute{
+				Required:    true,
+				Description: "The VM ID to run the command on.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"command": schema.StringAttribute{
+				Required:    true,
+				Description: "Shell command to run. VERS_EXEC_WHEN is set to the event that ran it: create, update or destroy.",
+			},
+			"when": schema.ListAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "Events to run the command on: any of \"create\", \"update\" and \"destroy\". An update is a change of 'command' or 'triggers'. Default: [\"create\", \"update\"].",
+			},
+			"triggers": schema.MapAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "Arbitrary values that run the command again when they change.",
+			},
+			"timeout": schema.StringAttribute{
+				Optional:    true,
+				Description: "Maximum run time, e.g. \"30s\" or \"10m\". Default: \"5m\".",
+			},
+			"allowed_exit_codes": schema.ListAttribute{
+				Optional:    true,
+				ElementType: types.Int64Type,
+				Description: "Exit codes that count as success. Default: [0].",
+			},
+			"stdout": schema.StringAttribute{
+				Computed:    true,
+				Description: fmt.Sprintf("Standard output of the last run (its last %d KiB).", maxResultOutput>>10),
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"stderr": schema.StringAttribute{
+				Computed:    true,
+				Description: fmt.Sprintf("Standard error of the last run (its last %d KiB).", maxResultOutput>>10),
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"exit_code": schema.Int64Attribute{
+				Computed:    true,
+				Description: "Exit code of the last run.",
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.UseStateForUnknown(),
+				},
+			},
+		},
+	}
+}
+
+func (r *VMExecResource) Configure(_ context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+	c, ok := req.ProviderData.(*client.Client)
+	if !ok {
+		resp.Diagnostics.AddError("Unexpected Resource Configure Type", "Expected *client.Client")
+		return
+	}
+	r.client = c
+}
+
+func (r *VMExecResource) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var config VMExecResourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &config)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !config.When.IsUnknown() {
+		seen := map[string]bool{}
+		for i, v := range config.When.Elements() {
+			s, ok := v.(types.String)
+			if !ok || !known(s) {
+				continue
+			}
+			e := s.ValueString()
+			switch {
+			case !execEvents[e]:
+				resp.Diagnostics.AddAttributeError(path.Root("when").AtListIndex(i), "Invalid event",
+					fmt.Sprintf("%q must be one of \"create\", \"update\" or \"destroy\".", e))
+			case seen[e]:
+				resp.Diagnostics.AddAttributeError(path.Root("when").AtListIndex(i), "Duplicate event",
+					fmt.Sprintf("%q is listed more than once.", e))
+			}
+			seen[e] = true
+		}
+	}
+	if _, err := durationOrDefault(config.Timeout, 0); err != nil {
+		resp.Diagnostics.AddAttributeError(path.Root("timeout"), "Invalid timeout", err.Error())
+	}
+}
+
+func (r *VMExecResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var plan VMExecResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	plan.ID = types.StringValue(fmt.Sprintf("%s:exec:%s", plan.VMID.ValueString(), client.RandomToken()))
+
+	if plan.runsOn(ctx, "create") {
+		r.run(ctx, &plan, "create", &resp.Diagnostics)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+	} else {
+		plan.Stdout = types.StringNull()
+		plan.Stderr = types.StringNull()
+		plan.ExitCode = types.Int64Null()
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+// Read only checks that the VM still exists: the command's effects can't be
+// observed, so there is nothing else to refresh.
+func (r *VMExecResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var state VMExecResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	vm, err := r.client.GetVM(state.VMID.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to verify VM exists", err.Error())
+		return
+	}
+	if vm == nil {
+		resp.State.RemoveResource(ctx)
+		return
+	}
+	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+}
+
+func (r *VMExecResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan, state VMExecResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if execRerun(ctx, plan, state) {
+		r.run(ctx, &plan, "update", &resp.Diagnostics)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+	} else {
+		// ModifyPlan left the outputs unknown if the inputs were; nothing
+		// ran, so they are still those of the last run.
+		plan.Stdout, plan.Stderr, plan.ExitCode = state.Stdout, state.Stderr, state.ExitCode
+	}
+
+	plan.ID = state.ID
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *VMExecResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var state VMExecResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() || !state.runsOn(ctx, "destroy") {
+		return
+	}
+
+	vmID := state.VMID.ValueString()
+	vm, err := r.client.GetVM(vmID)
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to verify VM exists", err.Error())
+		return
+	}
+	if vm == nil {
+		tflog.Debug(ctx, "VM already deleted, skipping destroy command", map[string]interface{}{"vm_id": vmID})
+		return
+	}
+
+	r.run(ctx, &state, "destroy", &resp.Diagnostics)
+}
+
+// ModifyPlan marks the outputs unknown when the update will run the command,
+// and leaves them at their state values otherwise.
+func (r *VMExecResource) ModifyPlan(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	if req.Plan.Raw.IsNull() || req.State.Raw.IsNull() {
+		return
+	}
+
+	var plan, state VMExecResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if plan.Command.IsUnknown() || plan.Triggers.IsUnknown() || plan.When.IsUnknown() || execRerun(ctx, plan, state) {
+		resp.Plan.SetAttribute(ctx, path.Root("stdout"), types.StringUnknown())
+		resp.Plan.SetAttribute(ctx, path.Root("stderr"), types.StringUnknown())
+		resp.Plan.SetAttribute(ctx, path.Root("exit_code"), types.Int64Unknown())
+	}
+}
+
+// execRerun reports whether an update from state to plan runs the command.
+func execRerun(ctx context.Context, plan, state VMExecResourceModel) bool {
+	changed := !plan.Command.Equal(state.Command) || !triggersEqual(plan.Triggers, state.Triggers)
+	return changed && plan.runsOn(ctx, "update")
+}
+
+// run executes the command for event and records its output in m. An exit
+// code outside allowed_exit_codes is reported as an error.
+func (r *VMExecResource) run(ctx context.Context, m *VMExecResourceModel, event string, diags *diag.Diagnostics) {
+	vmID := m.VMID.ValueString()
+	timeout, err := durationOrDefault(m.Timeout, defaultExecTimeout)
+	if err != nil {
+		diags.AddError("Invalid timeout", err.Error())
+		return
+	}
+
+	ssh := connectVM(ctx, r.client, vmID, diags)
+	if ssh == nil {
+		return
+	}
+	defer ssh.Cleanup()
+
+	tflog.Info(ctx, "Running command on Vers VM", map[string]interface{}{"vm_id": vmID, "when": event, "command": truncate(m.Command.ValueString(), 200)})
+	cmd := fmt.Sprintf("export VERS_EXEC_WHEN=%s\n%s", event, m.Command.ValueString())
+	res, err := runCommand(ctx, ssh, cmd, nil, timeout)
+	allowed := allowedExitCodes(ctx, m.AllowedExitCodes)
+	if err != nil || !exitCodeAllowed(res.ExitCode, allowed) {
+		diags.AddError(fmt.Sprintf("Command failed on %s", event), commandFailureDetail(err, res, allowed))
+		return
+	}
+
+	// Only the tail of the output is kept, where errors usually are.
+	m.Stdout = types.StringValue(truncateTail(res.Stdout, maxResultOutput))
+	m.Stderr = types.StringValue(truncateTail(res.Stderr, maxResultOutput))
+	m.ExitCode = types.Int64Value(int64(res.ExitCode))
+}
@@ -0,0 +1,46 @@
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+func TestExecRerun(t *testing.T) {
+	ctx := context.Background()
+	strs := func(v ...string) types.List {
+		l, _ := types.ListValueFrom(ctx, types.StringType, v)
+		return l
+	}
+	triggers := func(v string) types.Map {
+		m, _ := types.MapValueFrom(ctx, types.StringType, map[string]string{"version": v})
+		return m
+	}
+	always := types.ListNull(types.StringType)
+	noTriggers := types.MapNull(types.StringType)
+	model := func(cmd string, when types.List, trig types.Map) VMExecResourceModel {
+		return VMExecResourceModel{Command: types.StringValue(cmd), When: when, Triggers: trig}
+	}
+
+	tests := []struct {
+		name        string
+		plan, state VMExecResourceModel
+		wantRerun   bool
+	}{
+		{"nothing changed", model("make", always, triggers("1")), model("make", always, triggers("1")), false},
+		{"command changed", model("make all", always, noTriggers), model("make", always, noTriggers), true},
+		{"trigger changed", model("make", always, triggers("2")), model("make", always, triggers("1")), true},
+		{"trigger added", model("make", always, triggers("1")), model("make", always, noTriggers), true},
+		{"only when changed", model("make", strs("create"), triggers("1")), model("make", always, triggers("1")), false},
+		{"not run on update", model("make all", strs("create", "destroy"), triggers("2")), model("make", strs("create", "destroy"), triggers("1")), false},
+		{"run on update", model("make all", strs("update"), triggers("1")), model("make", strs("update"), triggers("1")), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := execRerun(ctx, tt.plan, tt.state); got != tt.wantRerun {
+				t.Errorf("execRerun = %v, want %v", got, tt.wantRerun)
+			}
+		})
+	}
+}
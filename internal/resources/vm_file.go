@@ -0,0 +1,375 @@
+package resources
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+
+	"github.com/hdresearch/vers-tf/internal/client"
+)
+
+var (
+	_ resource.Resource                   = &VMFileResource{}
+	_ resource.ResourceWithConfigure      = &VMFileResource{}
+	_ resource.ResourceWithModifyPlan     = &VMFileResource{}
+	_ resource.ResourceWithValidateConfig = &VMFileResource{}
+)
+
+type VMFileResource struct {
+	client *client.Client
+}
+
+type VMFileResourceModel struct {
+	ID            types.String `tfsdk:"id"`
+	VMID          types.String `tfsdk:"vm_id"`
+	Path          types.String `tfsdk:"path"`
+	Source        types.String `tfsdk:"source"`
+	Content       types.String `tfsdk:"content"`
+	ContentBase64 types.String `tfsdk:"content_base64"`
+	Mode          types.String `tfsdk:"mode"`
+	Owner         types.String `tfsdk:"owner"`
+	Group         types.String `tfsdk:"group"`
+	SHA256        types.String `tfsdk:"sha256"`
+}
+
+func NewVMFileResource() resource.Resource {
+	return &VMFileResource{}
+}
+
+func (r *VMFileResource) Metadata(_ context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_vm_file"
+}
+
+func (r *VMFileResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Manage a single file on a Vers VM. Unlike vers_provision, the file is checked on every refresh: " +
+			"changes made on the VM show up as drift in the plan and are overwritten on apply, and the file is removed on destroy.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:    true,
+				Description: "Resource ID ({vm_id}:{path}).",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"vm_id": schema.StringAttribute{
+				Required:    true,
+				Description: "The VM ID to manage the file on.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"path": schema.StringAttribute{
+				Required:    true,
+				Description: "Absolute path of the file on the VM.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"source": schema.StringAttribute{
+				Optional:    true,
+				Description: "Local file to upload. Exactly one of 'source', 'content' or 'content_base64' must be set.",
+			},
+			"content": schema.StringAttribute{
+				Optional:    true,
+				Description: "Inline content of the file. Supports templatefile() output.",
+			},
+			"content_base64": schema.StringAttribute{
+				Optional:    true,
+				Description: "Base64-encoded content, for binary files. Decoded before writing.",
+			},
+			"mode": schema.StringAttribute{
+				Optional:    true,
+				Description: "Octal permissions, e.g. \"0644\". Drift is detected when set.",
+			},
+			"owner": schema.StringAttribute{
+				Optional:    true,
+				Description: "User that owns the file. Drift is detected when set.",
+			},
+			"group": schema.StringAttribute{
+				Optional:    true,
+				Description: "Group that owns the file. Drift is detected when set.",
+			},
+			"sha256": schema.StringAttribute{
+				Computed:    true,
+				Description: "SHA-256 of the file content. Refreshed from the VM, so a change here in the plan means the file was modified outside Terraform.",
+			},
+		},
+	}
+}
+
+func (r *VMFileResource) Configure(_ context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+	c, ok := req.ProviderData.(*client.Client)
+	if !ok {
+		resp.Diagnostics.AddError("Unexpected Resource Configure Type", "Expected *client.Client")
+		return
+	}
+	r.client = c
+}
+
+func (r *VMFileResource) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var config VMFileResourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &config)...)
+	if resp.Diagnostics.HasError() || !known(config.Path) {
+		return
+	}
+	checkAbsolutePath(config.Path.ValueString(), path.Root("path"), "Invalid path", resp)
+}
+
+func (r *VMFileResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var plan VMFileResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	vmID := plan.VMID.ValueString()
+	remotePath := plan.Path.ValueString()
+	tflog.Debug(ctx, "Creating file on Vers VM", map[string]interface{}{"vm_id": vmID, "path": remotePath})
+
+	ssh := connectVM(ctx, r.client, vmID, &resp.Diagnostics)
+	if ssh == nil {
+		return
+	}
+	defer ssh.Cleanup()
+
+	sum, err := r.write(ctx, ssh, plan)
+	if err != nil {
+		resp.Diagnostics.AddError(fmt.Sprintf("Failed to write %s", remotePath), err.Error())
+		return
+	}
+
+	plan.ID = types.StringValue(fmt.Sprintf("%s:%s", vmID, remotePath))
+	plan.SHA256 = types.StringValue(sum)
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *VMFileResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var state VMFileResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	vmID := state.VMID.ValueString()
+	vm, err := r.client.GetVM(vmID)
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to verify VM exists", err.Error())
+		return
+	}
+	if vm == nil {
+		// VM was deleted — the file went with it
+		resp.State.RemoveResource(ctx)
+		return
+	}
+	if vm.State != "running" {
+		// A paused VM can't be inspected; keep the last known state.
+		tflog.Debug(ctx, "VM not running, skipping file refresh", map[string]interface{}{"vm_id": vmID, "state": vm.State})
+		resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+		return
+	}
+
+	ssh, err := r.client.ConnectSSH(vmID)
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to connect to VM", err.Error())
+		return
+	}
+	defer ssh.Cleanup()
+
+	info, err := ssh.StatFile(ctx, state.Path.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to read file from VM", err.Error())
+		return
+	}
+	if info == nil {
+		// File was deleted on the VM — plan to recreate it
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
+	state.SHA256 = types.StringValue(info.SHA256)
+	if !state.Mode.IsNull() && !sameMode(state.Mode.ValueString(), info.Mode) {
+		state.Mode = types.StringValue(normalizeMode(info.Mode))
+	}
+	if !state.Owner.IsNull() && state.Owner.ValueString() != info.Owner {
+		state.Owner = types.StringValue(info.Owner)
+	}
+	if !state.Group.IsNull() && state.Group.ValueString() != info.Group {
+		state.Group = types.StringValue(info.Group)
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+}
+
+func (r *VMFileResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	// Content, permissions or ownership changed (or drifted) — rewrite in place.
+	var plan, state VMFileResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	remotePath := plan.Path.ValueString()
+	tflog.Debug(ctx, "Rewriting file on Vers VM", map[string]interface{}{"vm_id": plan.VMID.ValueString(), "path": remotePath})
+
+	ssh := connectVM(ctx, r.client, plan.VMID.ValueString(), &resp.Diagnostics)
+	if ssh == nil {
+		return
+	}
+	defer ssh.Cleanup()
+
+	sum, err := r.write(ctx, ssh, plan)
+	if err != nil {
+		resp.Diagnostics.AddError(fmt.Sprintf("Failed to write %s", remotePath), err.Error())
+		return
+	}
+
+	plan.ID = state.ID
+	plan.SHA256 = types.StringValue(sum)
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *VMFileResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var state VMFileResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	vmID := state.VMID.ValueString()
+	vm, err := r.client.GetVM(vmID)
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to verify VM exists", err.Error())
+		return
+	}
+	if vm == nil {
+		tflog.Debug(ctx, "VM already deleted, nothing to remove", map[string]interface{}{"vm_id": vmID})
+		return
+	}
+
+	ssh, err := r.client.ConnectSSH(vmID)
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to connect to VM", err.Error())
+		return
+	}
+	defer ssh.Cleanup()
+
+	tflog.Debug(ctx, "Removing file from Vers VM", map[string]interface{}{"vm_id": vmID, "path": state.Path.ValueString()})
+	if err := ssh.RemoveFile(ctx, state.Path.ValueString()); err != nil {
+		resp.Diagnostics.AddError("Failed to remove file from VM", err.Error())
+		return
+	}
+}
+
+// ModifyPlan sets the planned sha256 from the configured content, so that a
+// file changed on the VM (refreshed into state by Read) shows up as a diff.
+func (r *VMFileResource) ModifyPlan(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	if req.Plan.Raw.IsNull() {
+		return
+	}
+
+	var plan VMFileResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	if plan.Source.IsUnknown() || plan.Content.IsUnknown() || plan.ContentBase64.IsUnknown() {
+		return
+	}
+
+	rc, err := vmFileContent(plan)
+	if err != nil {
+		resp.Diagnostics.AddError("Invalid file content", err.Error())
+		return
+	}
+	defer rc.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, rc); err != nil {
+		resp.Diagnostics.AddError("Failed to hash file content", err.Error())
+		return
+	}
+	resp.Plan.SetAttribute(ctx, path.Root("sha256"), types.StringValue(hex.EncodeToString(h.Sum(nil))))
+}
+
+// write uploads the configured content and returns its sha256.
+func (r *VMFileResource) write(ctx context.Context, ssh *client.SSHClient, m VMFileResourceModel) (string, error) {
+	rc, err := vmFileContent(m)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	h := sha256.New()
+	attrs := client.FileAttrs{
+		Mode:  m.Mode.ValueString(),
+		Owner: m.Owner.ValueString(),
+		Group: m.Group.ValueString(),
+	}
+	if err := ssh.WriteStream(ctx, m.Path.ValueString(), io.TeeReader(rc, h), attrs); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// vmFileContent opens whichever content source is configured.
+func vmFileContent(m VMFileResourceModel) (io.ReadCloser, error) {
+	set := 0
+	for _, v := range []types.String{m.Source, m.Content, m.ContentBase64} {
+		if !v.IsNull() {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, fmt.Errorf("exactly one of 'source', 'content' or 'content_base64' must be set")
+	}
+
+	switch {
+	case !m.Source.IsNull():
+		return os.Open(m.Source.ValueString())
+	case !m.ContentBase64.IsNull():
+		encoded := m.ContentBase64.ValueString()
+		if _, err := base64.StdEncoding.DecodeString(encoded); err != nil {
+			return nil, fmt.Errorf("'content_base64' is not valid base64: %w", err)
+		}
+		return io.NopCloser(base64.NewDecoder(base64.StdEncoding, strings.NewReader(encoded))), nil
+	default:
+		return io.NopCloser(strings.NewReader(m.Content.ValueString())), nil
+	}
+}
+
+// sameMode compares two octal mode strings numerically ("644" == "0644").
+func sameMode(a, b string) bool {
+	x, errA := strconv.ParseUint(a, 8, 32)
+	y, errB := strconv.ParseUint(b, 8, 32)
+	return errA == nil && errB == nil && x == y
+}
+
+// normalizeMode formats an octal mode string with four digits.
+func normalizeMode(mode string) string {
+	v, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return mode
+	}
+	return fmt.Sprintf("%04o", v)
+}
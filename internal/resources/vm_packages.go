@@ -0,0 +1,587 @@
+package resources
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+
+	"github.com/hdresearch/vers-tf/internal/client"
+)
+
+var (
+	_ resource.Resource                   = &VMPackagesResource{}
+	_ resource.ResourceWithConfigure      = &VMPackagesResource{}
+	_ resource.ResourceWithValidateConfig = &VMPackagesResource{}
+)
+
+const (
+	defaultPackagesTimeout = 15 * time.Minute
+	aptSourcesDir          = "/etc/apt/sources.list.d"
+	aptKeyringsDir         = "/etc/apt/keyrings"
+)
+
+var (
+	aptPackagePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]+(:[a-z0-9-]+)?$`)
+	aptVersionPattern = regexp.MustCompile(`^[A-Za-z0-9.+~:-]*$`)
+	aptRepoPattern    = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+)
+
+type VMPackagesResource struct {
+	client *client.Client
+}
+
+type VMPackagesResourceModel struct {
+	ID              types.String `tfsdk:"id"`
+	VMID            types.String `tfsdk:"vm_id"`
+	Packages        types.Map    `tfsdk:"packages"`
+	Repositories    types.List   `tfsdk:"repositories"`
+	RemoveOnDestroy types.Bool   `tfsdk:"remove_on_destroy"`
+	Timeout         types.String `tfsdk:"timeout"`
+	Installed       types.Map    `tfsdk:"installed"`
+}
+
+// AptRepository is an extra apt source, optionally signed by its own key.
+type AptRepository struct {
+	Name       types.String `tfsdk:"name"`
+	URI        types.String `tfsdk:"uri"`
+	Suite      types.String `tfsdk:"suite"`
+	Components types.List   `tfsdk:"components"`
+	Key        types.String `tfsdk:"key"`
+}
+
+func (a AptRepository) listPath() string {
+	return fmt.Sprintf("%s/vers-%s.list", aptSourcesDir, a.Name.ValueString())
+}
+
+func (a AptRepository) keyPath() string {
+	return fmt.Sprintf("%s/vers-%s.asc", aptKeyringsDir, a.Name.ValueString())
+}
+
+// sourceLine renders the one-line apt source for the repository.
+func (a AptRepository) sourceLine(ctx context.Context) string {
+	opts := ""
+	if a.Key.ValueString() != "" {
+		opts = fmt.Sprintf("[signed-by=%s] ", a.keyPath())
+	}
+	parts := append([]string{a.URI.ValueString(), a.Suite.ValueString()}, stringList(ctx, a.Components)...)
+	return "deb " + opts + strings.Join(parts, " ") + "\n"
+}
+
+func NewVMPackagesResource() resource.Resource {
+	return &VMPackagesResource{}
+}
+
+func (r *VMPackagesResource) Metadata(_ context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_vm_packages"
+}
+
+func (r *VMPackagesResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Manage apt packages on a Debian or Ubuntu Vers VM. Installed versions are read back with dpkg-query on every refresh, " +
+			"so packages that were removed or upgraded on the VM show up as drift in the plan and are reinstalled on apply.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:    true,
+				Description: "Resource ID.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"vm_id": schema.StringAttribute{
+				Required:    true,
+				Description: "The VM ID to manage packages on.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"packages": schema.MapAttribute{
+				Required:    true,
+				ElementType: types.StringType,
+				Description: "Packages to install, keyed by name. The value pins an exact version (as shown by 'apt-cache policy'); " +
+					"an empty string accepts any installed version and installs the candidate if the package is missing.",
+			},
+			"repositories": schema.ListNestedAttribute{
+				Optional:    true,
+				Description: "Extra apt repositories to add before installing. Each is written to " + aptSourcesDir + "/vers-<name>.list.",
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"name": schema.StringAttribute{
+							Required:    true,
+							Description: "Short unique name, used for the list and key file names.",
+						},
+						"uri": schema.StringAttribute{
+							Required:    true,
+							Description: "Repository URL, e.g. \"https://download.docker.com/linux/ubuntu\".",
+						},
+						"suite": schema.StringAttribute{
+							Required:    true,
+							Description: "Distribution or suite, e.g. \"jammy\".",
+						},
+						"components": schema.ListAttribute{
+							Optional:    true,
+							ElementType: types.StringType,
+							Description: "Components, e.g. [\"stable\"]. Each must be non-empty and contain no whitespace.",
+						},
+						"key": schema.StringAttribute{
+							Optional: true,
+							Description: "ASCII-armored signing key. Written to " + aptKeyringsDir + "/vers-<name>.asc and referenced with signed-by. " +
+								"Use the http data source to fetch a published key.",
+						},
+					},
+				},
+			},
+			"remove_on_destroy": schema.BoolAttribute{
+				Optional: true,
+				Description: "Remove the packages (and the repositories) when the resource is destroyed, and remove packages dropped from " +
+					"'packages' on update. Repositories dropped from 'repositories' are always removed. Default: false (packages stay installed).",
+			},
+			"timeout": schema.StringAttribute{
+				Optional:    true,
+				Description: "Maximum time for each apt-get run, e.g. \"30m\". Default: \"15m\".",
+			},
+			"installed": schema.MapAttribute{
+				Computed:    true,
+				ElementType: types.StringType,
+				Description: "Installed version of each package, as reported by dpkg-query.",
+			},
+		},
+	}
+}
+
+func (r *VMPackagesResource) Configure(_ context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+	c, ok := req.ProviderData.(*client.Client)
+	if !ok {
+		resp.Diagnostics.AddError("Unexpected Resource Configure Type", "Expected *client.Client")
+		return
+	}
+	r.client = c
+}
+
+// ValidateConfig checks package names, versions and repositories, so that
+// nothing reaches the shell unvalidated.
+func (r *VMPackagesResource) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var config VMPackagesResourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &config)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !config.Packages.IsUnknown() {
+		for name, elem := range config.Packages.Elements() {
+			p := path.Root("packages").AtMapKey(name)
+			if !aptPackagePattern.MatchString(name) {
+				resp.Diagnostics.AddAttributeError(p, "Invalid package name", fmt.Sprintf("%q is not a valid apt package name.", name))
+			}
+			if v, ok := elem.(types.String); ok && known(v) && !aptVersionPattern.MatchString(v.ValueString()) {
+				resp.Diagnostics.AddAttributeError(p, "Invalid package version", fmt.Sprintf("%q is not a valid package version.", v.ValueString()))
+			}
+		}
+	}
+
+	if _, err := durationOrDefault(config.Timeout, 0); err != nil {
+		resp.Diagnostics.AddAttributeError(path.Root("timeout"), "Invalid timeout", err.Error())
+	}
+
+	repos, _ := aptRepositories(ctx, config.Repositories)
+	seen := map[string]bool{}
+	for i, repo := range repos {
+		p := path.Root("repositories").AtListIndex(i)
+		if !known(repo.Name) {
+			continue
+		}
+		name := repo.Name.ValueString()
+		if !aptRepoPattern.MatchString(name) {
+			resp.Diagnostics.AddAttributeError(p.AtName("name"), "Invalid repository name",
+				fmt.Sprintf("%q must contain only lowercase letters, digits, '.', '_' and '-'.", name))
+		}
+		if seen[name] {
+			resp.Diagnostics.AddAttributeError(p.AtName("name"), "Duplicate repository name", fmt.Sprintf("%q is used more than once.", name))
+		}
+		seen[name] = true
+		for attr, v := range map[string]types.String{"uri": repo.URI, "suite": repo.Suite} {
+			if known(v) && (v.ValueString() == "" || strings.ContainsAny(v.ValueString(), " \t\n")) {
+				resp.Diagnostics.AddAttributeError(p.AtName(attr), "Invalid repository "+attr, "Must be non-empty and contain no whitespace.")
+			}
+		}
+		if !repo.Components.IsUnknown() {
+			for j, elem := range repo.Components.Elements() {
+				if v, ok := elem.(types.String); ok && known(v) && (v.ValueString() == "" || strings.ContainsAny(v.ValueString(), " \t\n")) {
+					resp.Diagnostics.AddAttributeError(p.AtName("components").AtListIndex(j), "Invalid repository component",
+						"Must be non-empty and contain no whitespace.")
+				}
+			}
+		}
+	}
+}
+
+func (r *VMPackagesResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var plan VMPackagesResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	vmID := plan.VMID.ValueString()
+	tflog.Info(ctx, "Installing packages on Vers VM", map[string]interface{}{"vm_id": vmID})
+
+	ssh := connectVM(ctx, r.client, vmID, &resp.Diagnostics)
+	if ssh == nil {
+		return
+	}
+	defer ssh.Cleanup()
+
+	r.apply(ctx, ssh, &plan, nil, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	h := sha256.New()
+	for _, name := range sortedKeys(stringMap(ctx, plan.Packages)) {
+		fmt.Fprintf(h, "%s\x00", name)
+	}
+	plan.ID = types.StringValue(fmt.Sprintf("%s:packages:%s", vmID, hex.EncodeToString(h.Sum(nil))[:12]))
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *VMPackagesResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var state VMPackagesResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	vmID := state.VMID.ValueString()
+	vm, err := r.client.GetVM(vmID)
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to verify VM exists", err.Error())
+		return
+	}
+	if vm == nil {
+		// VM was deleted — the packages went with it
+		resp.State.RemoveResource(ctx)
+		return
+	}
+	if vm.State != "running" {
+		// A paused VM can't be inspected; keep the last known state.
+		tflog.Debug(ctx, "VM not running, skipping package refresh", map[string]interface{}{"vm_id": vmID, "state": vm.State})
+		resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+		return
+	}
+
+	ssh, err := r.client.ConnectSSH(vmID)
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to connect to VM", err.Error())
+		return
+	}
+	defer ssh.Cleanup()
+
+	wanted := stringMap(ctx, state.Packages)
+	installed, err := installedPackages(ctx, ssh, sortedKeys(wanted))
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to read installed packages from VM", err.Error())
+		return
+	}
+
+	// Record what is actually there: a missing package drops out of the map
+	// and a pinned package that moved reports its real version, so the plan
+	// shows the difference from the configuration.
+	actual := map[string]string{}
+	for name, pin := range wanted {
+		v, ok := installed[name]
+		switch {
+		case !ok:
+		case pin != "" && v != pin:
+			actual[name] = v
+		default:
+			actual[name] = pin
+		}
+	}
+	var d diag.Diagnostics
+	state.Packages, d = types.MapValueFrom(ctx, types.StringType, actual)
+	resp.Diagnostics.Append(d...)
+	state.Installed, d = types.MapValueFrom(ctx, types.StringType, installed)
+	resp.Diagnostics.Append(d...)
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+}
+
+func (r *VMPackagesResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan, state VMPackagesResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	tflog.Info(ctx, "Updating packages on Vers VM", map[string]interface{}{"vm_id": plan.VMID.ValueString()})
+
+	ssh := connectVM(ctx, r.client, plan.VMID.ValueString(), &resp.Diagnostics)
+	if ssh == nil {
+		return
+	}
+	defer ssh.Cleanup()
+
+	r.apply(ctx, ssh, &plan, &state, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	plan.ID = state.ID
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *VMPackagesResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var state VMPackagesResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	if !state.RemoveOnDestroy.ValueBool() {
+		tflog.Debug(ctx, "Leaving packages installed", map[string]interface{}{"vm_id": state.VMID.ValueString()})
+		return
+	}
+
+	vmID := state.VMID.ValueString()
+	vm, err := r.client.GetVM(vmID)
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to verify VM exists", err.Error())
+		return
+	}
+	if vm == nil {
+		tflog.Debug(ctx, "VM already deleted, nothing to remove", map[string]interface{}{"vm_id": vmID})
+		return
+	}
+
+	ssh := connectVM(ctx, r.client, vmID, &resp.Diagnostics)
+	if ssh == nil {
+		return
+	}
+	defer ssh.Cleanup()
+
+	timeout, _ := durationOrDefault(state.Timeout, defaultPackagesTimeout)
+	if names := sortedKeys(stringMap(ctx, state.Packages)); len(names) > 0 {
+		tflog.Info(ctx, fmt.Sprintf("Removing %d package(s) from the VM", len(names)))
+		if err := runChecked(ctx, ssh, aptCommand("remove", names), timeout); err != nil {
+			resp.Diagnostics.AddError("Failed to remove packages", err.Error())
+			return
+		}
+	}
+
+	repos, _ := aptRepositories(ctx, state.Repositories)
+	if err := removeAptRepositories(ctx, ssh, repos); err != nil {
+		resp.Diagnostics.AddError("Failed to remove apt repositories", err.Error())
+	}
+}
+
+// apply brings the VM in line with plan: it writes the repositories, removes
+// the ones that prev had but plan no longer does, installs missing or
+// mismatched packages and, with remove_on_destroy, removes the packages that
+// prev had but plan no longer does. prev is nil on create. plan.Installed is set from the VM afterwards.
+func (r *VMPackagesResource) apply(ctx context.Context, ssh *client.SSHClient, plan, prev *VMPackagesResourceModel, diags *diag.Diagnostics) {
+	timeout, err := durationOrDefault(plan.Timeout, defaultPackagesTimeout)
+	if err != nil {
+		diags.AddError("Invalid timeout", err.Error())
+		return
+	}
+	wanted := stringMap(ctx, plan.Packages)
+	repos, d := aptRepositories(ctx, plan.Repositories)
+	diags.Append(d...)
+	if diags.HasError() {
+		return
+	}
+
+	// Repositories
+	reposChanged := prev == nil || !plan.Repositories.Equal(prev.Repositories)
+	if reposChanged {
+		for _, repo := range repos {
+			if key := repo.Key.ValueString(); key != "" {
+				if err := ssh.WriteStream(ctx, repo.keyPath(), strings.NewReader(key), client.FileAttrs{Mode: "0644"}); err != nil {
+					diags.AddError(fmt.Sprintf("Failed to write key for repository %q", repo.Name.ValueString()), err.Error())
+					return
+				}
+			}
+			if err := ssh.WriteStream(ctx, repo.listPath(), strings.NewReader(repo.sourceLine(ctx)), client.FileAttrs{Mode: "0644"}); err != nil {
+				diags.AddError(fmt.Sprintf("Failed to add repository %q", repo.Name.ValueString()), err.Error())
+				return
+			}
+		}
+	}
+
+	// A repository left in sources.list.d would keep feeding apt, so one
+	// dropped from the configuration is always removed.
+	if prev != nil {
+		var oldRepos []AptRepository
+		prevRepos, _ := aptRepositories(ctx, prev.Repositories)
+		for _, old := range prevRepos {
+			if !containsRepo(repos, old.Name.ValueString()) {
+				oldRepos = append(oldRepos, old)
+			}
+		}
+		if err := removeAptRepositories(ctx, ssh, oldRepos); err != nil {
+			diags.AddError("Failed to remove apt repositories", err.Error())
+			return
+		}
+	}
+
+	var dropped []string
+	if prev != nil && plan.RemoveOnDestroy.ValueBool() {
+		for name := range stringMap(ctx, prev.Packages) {
+			if _, ok := wanted[name]; !ok {
+				dropped = append(dropped, name)
+			}
+		}
+		if len(dropped) > 0 {
+			sort.Strings(dropped)
+			tflog.Info(ctx, fmt.Sprintf("Removing %d package(s) dropped from the configuration", len(dropped)))
+			if err := runChecked(ctx, ssh, aptCommand("remove", dropped), timeout); err != nil {
+				diags.AddError("Failed to remove packages", err.Error())
+				return
+			}
+		}
+	}
+
+	// Packages
+	installed, err := installedPackages(ctx, ssh, sortedKeys(wanted))
+	if err != nil {
+		diags.AddError("Failed to read installed packages from VM", err.Error())
+		return
+	}
+	var install []string
+	for _, name := range sortedKeys(wanted) {
+		v, ok := installed[name]
+		switch pin := wanted[name]; {
+		case !ok && pin == "":
+			install = append(install, name)
+		case pin != "" && v != pin:
+			install = append(install, name+"="+pin)
+		}
+	}
+
+	if reposChanged || len(install) > 0 {
+		tflog.Info(ctx, "Updating apt package lists")
+		if err := runChecked(ctx, ssh, aptCommand("update", nil), timeout); err != nil {
+			diags.AddError("apt-get update failed", err.Error())
+			return
+		}
+	}
+	if len(install) > 0 {
+		tflog.Info(ctx, fmt.Sprintf("Installing %d package(s): %s", len(install), truncate(strings.Join(install, " "), 200)))
+		if err := runChecked(ctx, ssh, aptCommand("install", install), timeout); err != nil {
+			diags.AddError("Failed to install packages", err.Error())
+			return
+		}
+		if installed, err = installedPackages(ctx, ssh, sortedKeys(wanted)); err != nil {
+			diags.AddError("Failed to read installed packages from VM", err.Error())
+			return
+		}
+	}
+
+	// apt may resolve a pin differently than expected; don't record a
+	// state the VM doesn't have.
+	for _, name := range sortedKeys(wanted) {
+		v, ok := installed[name]
+		if !ok {
+			diags.AddError(fmt.Sprintf("Package %s is not installed", name), "apt-get reported success, but dpkg-query does not list the package as installed.")
+		} else if pin := wanted[name]; pin != "" && v != pin {
+			diags.AddError(fmt.Sprintf("Package %s has version %s, not %s", name, v, pin),
+				"The pinned version could not be installed. Check the available versions with 'apt-cache policy'.")
+		}
+	}
+	m, d := types.MapValueFrom(ctx, types.StringType, installed)
+	diags.Append(d...)
+	plan.Installed = m
+}
+
+// aptCommand builds a non-interactive apt-get invocation that waits for
+// the dpkg lock (e.g. held by unattended-upgrades) instead of failing.
+func aptCommand(action string, args []string) string {
+	var b strings.Builder
+	b.WriteString("DEBIAN_FRONTEND=noninteractive apt-get -q -y -o DPkg::Lock::Timeout=300")
+	switch action {
+	case "install":
+		b.WriteString(" -o Dpkg::Options::=--force-confdef -o Dpkg::Options::=--force-confold --allow-downgrades")
+	}
+	b.WriteString(" " + action)
+	for _, a := range args {
+		fmt.Fprintf(&b, " '%s'", client.ShellEscape(a))
+	}
+	return b.String()
+}
+
+// installedPackages returns the version of each installed package in names,
+// in one round trip. Packages that are missing or only partly installed are
+// left out.
+func installedPackages(ctx context.Context, ssh *client.SSHClient, names []string) (map[string]string, error) {
+	out := map[string]string{}
+	if len(names) == 0 {
+		return out, nil
+	}
+	var b strings.Builder
+	b.WriteString("for p in")
+	for _, n := range names {
+		fmt.Fprintf(&b, " '%s'", client.ShellEscape(n))
+	}
+	b.WriteString(`; do v=$(dpkg-query -W -f='${db:Status-Status} ${Version}\n' "$p" 2>/dev/null | head -n1); printf '%s\t%s\n' "$p" "$v"; done`)
+
+	stdout, err := ssh.ExecWithTimeout(ctx, b.String(), 2*time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("query installed packages: %w", err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+		name, status, _ := strings.Cut(line, "\t")
+		if state, version, ok := strings.Cut(status, " "); ok && state == "installed" {
+			out[name] = version
+		}
+	}
+	return out, nil
+}
+
+// removeAptRepositories deletes the list and key files of repos.
+func removeAptRepositories(ctx context.Context, ssh *client.SSHClient, repos []AptRepository) error {
+	if len(repos) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	b.WriteString("rm -f --")
+	for _, repo := range repos {
+		fmt.Fprintf(&b, " '%s' '%s'", client.ShellEscape(repo.listPath()), client.ShellEscape(repo.keyPath()))
+	}
+	_, err := ssh.ExecWithTimeout(ctx, b.String(), 2*time.Minute)
+	return err
+}
+
+func aptRepositories(ctx context.Context, l types.List) ([]AptRepository, diag.Diagnostics) {
+	if l.IsNull() || l.IsUnknown() {
+		return nil, nil
+	}
+	var repos []AptRepository
+	diags := l.ElementsAs(ctx, &repos, false)
+	return repos, diags
+}
+
+func containsRepo(repos []AptRepository, name string) bool {
+	for _, r := range repos {
+		if r.Name.ValueString() == name {
+			return true
+		}
+	}
+	return false
+}
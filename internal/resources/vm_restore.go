@@ -2,7 +2,6 @@ package resources
 
 import (
 	"context"
-	"fmt"
 	"time"
 
 	"github.com/hashicorp/terraform-plugin-framework/resource"
@@ -111,7 +110,7 @@ func (r *VMRestoreResource) Create(ctx context.Context, req resource.CreateReque
 
 	vmID := result.VMID
 	plan.ID = types.StringValue(vmID)
-	plan.SSHHost = types.StringValue(fmt.Sprintf("%s.vm.vers.sh", vmID))
+	plan.SSHHost = types.StringValue(r.client.VMHost(vmID))
 
 	// Wait for the restored VM to be running
 	if err := r.client.WaitForBoot(vmID, 3*time.Minute); err != nil {
@@ -160,7 +159,7 @@ func (r *VMRestoreResource) Read(ctx context.Context, req resource.ReadRequest,
 
 	state.State = types.StringValue(vm.State)
 	state.CreatedAt = types.StringValue(vm.CreatedAt)
-	state.SSHHost = types.StringValue(fmt.Sprintf("%s.vm.vers.sh", vm.VMID))
+	state.SSHHost = types.StringValue(r.client.VMHost(vm.VMID))
 
 	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
 }
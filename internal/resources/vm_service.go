@@ -0,0 +1,525 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+
+	"github.com/hdresearch/vers-tf/internal/client"
+)
+
+var (
+	_ resource.Resource                   = &VMServiceResource{}
+	_ resource.ResourceWithConfigure      = &VMServiceResource{}
+	_ resource.ResourceWithModifyPlan     = &VMServiceResource{}
+	_ resource.ResourceWithValidateConfig = &VMServiceResource{}
+)
+
+const (
+	defaultServiceTimeout = 60 * time.Second
+	systemdUnitDir        = "/etc/systemd/system"
+)
+
+var (
+	unitNamePattern = regexp.MustCompile(`^[A-Za-z0-9:_.@-]+$`)
+	unitSuffixes    = []string{".service", ".socket", ".timer", ".path", ".mount", ".target"}
+	// Unit file states that say whether the unit starts at boot. Others,
+	// such as "static" or "generated", cannot be enabled or disabled.
+	unitFileEnabled = map[string]bool{"enabled": true, "enabled-runtime": true, "disabled": false, "masked": false, "masked-runtime": false}
+)
+
+type VMServiceResource struct {
+	client *client.Client
+}
+
+type VMServiceResourceModel struct {
+	ID              types.String `tfsdk:"id"`
+	VMID            types.String `tfsdk:"vm_id"`
+	Name            types.String `tfsdk:"name"`
+	Content         types.String `tfsdk:"content"`
+	Enabled         types.Bool   `tfsdk:"enabled"`
+	Active          types.Bool   `tfsdk:"active"`
+	RestartTriggers types.Map    `tfsdk:"restart_triggers"`
+	Timeout         types.String `tfsdk:"timeout"`
+	ContentSHA256   types.String `tfsdk:"content_sha256"`
+	ActiveState     types.String `tfsdk:"active_state"`
+	SubState        types.String `tfsdk:"sub_state"`
+	UnitFileState   types.String `tfsdk:"unit_file_state"`
+}
+
+// unit returns the full unit name, defaulting to a .service unit.
+func (m VMServiceResourceModel) unit() string {
+	name := m.Name.ValueString()
+	for _, suffix := range unitSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return name
+		}
+	}
+	return name + ".service"
+}
+
+func (m VMServiceResourceModel) unitPath() string {
+	return systemdUnitDir + "/" + m.unit()
+}
+
+func NewVMServiceResource() resource.Resource {
+	return &VMServiceResource{}
+}
+
+func (r *VMServiceResource) Metadata(_ context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_vm_service"
+}
+
+func (r *VMServiceResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Manage a systemd unit on a Vers VM: its unit file, whether it is enabled and whether it is running. " +
+			"The actual unit state is read back on every refresh, so a stopped, disabled or edited unit shows up as drift in the plan.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:    true,
+				Description: "Resource ID ({vm_id}:{unit}).",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"vm_id": schema.StringAttribute{
+				Required:    true,
+				Description: "The VM ID to manage the service on.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"name": schema.StringAttribute{
+				Required:    true,
+				Description: "Unit name, e.g. \"app\" or \"app.timer\". Without a unit suffix, \".service\" is assumed.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"content": schema.StringAttribute{
+				Optional: true,
+				Description: "Unit file content, written to " + systemdUnitDir + "/<unit>. Omit to manage an existing unit, " +
+					"e.g. one installed by a package. A managed unit file is removed on destroy.",
+			},
+			"enabled": schema.BoolAttribute{
+				Optional:    true,
+				Computed:    true,
+				Default:     booldefault.StaticBool(true),
+				Description: "Start the unit at boot. Default: true.",
+			},
+			"active": schema.BoolAttribute{
+				Optional:    true,
+				Computed:    true,
+				Default:     booldefault.StaticBool(true),
+				Description: "Keep the unit running. A Type=oneshot unit counts as running once its command has succeeded. Default: true.",
+			},
+			"restart_triggers": schema.MapAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "Arbitrary values that restart the unit when they change, e.g. the sha256 of a config file it reads.",
+			},
+			"timeout": schema.StringAttribute{
+				Optional:    true,
+				Description: "How long to wait for the unit to become active after a start or restart, e.g. \"2m\". Default: \"60s\".",
+			},
+			"content_sha256": schema.StringAttribute{
+				Computed:    true,
+				Description: "SHA-256 of the unit file on the VM (empty if it is missing). Only set with 'content'.",
+			},
+			"active_state": schema.StringAttribute{
+				Computed:    true,
+				Description: "ActiveState reported by systemd, e.g. \"active\" or \"failed\".",
+			},
+			"sub_state": schema.StringAttribute{
+				Computed:    true,
+				Description: "SubState reported by systemd, e.g. \"running\" or \"exited\".",
+			},
+			"unit_file_state": schema.StringAttribute{
+				Computed:    true,
+				Description: "UnitFileState reported by systemd, e.g. \"enabled\", \"disabled\" or \"static\".",
+			},
+		},
+	}
+}
+
+func (r *VMServiceResource) Configure(_ context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+	c, ok := req.ProviderData.(*client.Client)
+	if !ok {
+		resp.Diagnostics.AddError("Unexpected Resource Configure Type", "Expected *client.Client")
+		return
+	}
+	r.client = c
+}
+
+func (r *VMServiceResource) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var config VMServiceResourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &config)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if known(config.Name) && !unitNamePattern.MatchString(config.Name.ValueString()) {
+		resp.Diagnostics.AddAttributeError(path.Root("name"), "Invalid unit name",
+			fmt.Sprintf("%q is not a valid systemd unit name.", config.Name.ValueString()))
+	}
+	if _, err := durationOrDefault(config.Timeout, 0); err != nil {
+		resp.Diagnostics.AddAttributeError(path.Root("timeout"), "Invalid timeout", err.Error())
+	}
+}
+
+func (r *VMServiceResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var plan VMServiceResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	vmID := plan.VMID.ValueString()
+	tflog.Info(ctx, "Configuring service on Vers VM", map[string]interface{}{"vm_id": vmID, "unit": plan.unit()})
+
+	ssh := connectVM(ctx, r.client, vmID, &resp.Diagnostics)
+	if ssh == nil {
+		return
+	}
+	defer ssh.Cleanup()
+
+	// A unit we write may already be running from an older file, so
+	// restart it; an existing unit we only adopt is just started.
+	managed := !plan.Content.IsNull()
+	r.apply(ctx, ssh, &plan, managed, managed, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	plan.ID = types.StringValue(fmt.Sprintf("%s:%s", vmID, plan.unit()))
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *VMServiceResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var state VMServiceResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	vmID := state.VMID.ValueString()
+	vm, err := r.client.GetVM(vmID)
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to verify VM exists", err.Error())
+		return
+	}
+	if vm == nil {
+		// VM was deleted — the service went with it
+		resp.State.RemoveResource(ctx)
+		return
+	}
+	if vm.State != "running" {
+		// A paused VM can't be inspected; keep the last known state.
+		tflog.Debug(ctx, "VM not running, skipping service refresh", map[string]interface{}{"vm_id": vmID, "state": vm.State})
+		resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+		return
+	}
+
+	ssh, err := r.client.ConnectSSH(vmID)
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to connect to VM", err.Error())
+		return
+	}
+	defer ssh.Cleanup()
+
+	status, err := unitStatus(ctx, ssh, state)
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to read service status from VM", err.Error())
+		return
+	}
+
+	// Record what the VM reports, so the plan shows any difference from
+	// the configuration.
+	status.apply(&state)
+	if enabled, ok := unitFileEnabled[status.UnitFileState]; ok {
+		state.Enabled = types.BoolValue(enabled)
+	}
+	state.Active = types.BoolValue(status.up())
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+}
+
+func (r *VMServiceResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan, state VMServiceResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	tflog.Info(ctx, "Updating service on Vers VM", map[string]interface{}{"vm_id": plan.VMID.ValueString(), "unit": plan.unit()})
+
+	ssh := connectVM(ctx, r.client, plan.VMID.ValueString(), &resp.Diagnostics)
+	if ssh == nil {
+		return
+	}
+	defer ssh.Cleanup()
+
+	// state.ContentSHA256 was refreshed from the VM, so this also catches
+	// a unit file edited by hand.
+	writeUnit := !plan.Content.IsNull() && !plan.ContentSHA256.Equal(state.ContentSHA256)
+	restart := writeUnit || !triggersEqual(plan.RestartTriggers, state.RestartTriggers)
+	r.apply(ctx, ssh, &plan, writeUnit, restart, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	plan.ID = state.ID
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *VMServiceResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var state VMServiceResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	if state.Content.IsNull() {
+		// The unit belongs to someone else (e.g. a package); leave it be.
+		tflog.Debug(ctx, "Unit file not managed, leaving service as is", map[string]interface{}{"unit": state.unit()})
+		return
+	}
+
+	vmID := state.VMID.ValueString()
+	vm, err := r.client.GetVM(vmID)
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to verify VM exists", err.Error())
+		return
+	}
+	if vm == nil {
+		tflog.Debug(ctx, "VM already deleted, nothing to remove", map[string]interface{}{"vm_id": vmID})
+		return
+	}
+
+	ssh := connectVM(ctx, r.client, vmID, &resp.Diagnostics)
+	if ssh == nil {
+		return
+	}
+	defer ssh.Cleanup()
+
+	unit := client.ShellEscape(state.unit())
+	cmd := fmt.Sprintf("systemctl disable --now '%s' 2>/dev/null; rm -f '%s' && systemctl daemon-reload && systemctl reset-failed '%s' 2>/dev/null; true",
+		unit, client.ShellEscape(state.unitPath()), unit)
+	if err := runChecked(ctx, ssh, cmd, 2*time.Minute); err != nil {
+		resp.Diagnostics.AddError(fmt.Sprintf("Failed to remove %s", state.unit()), err.Error())
+	}
+}
+
+// ModifyPlan sets the planned content_sha256 from the configured content, so
+// that a unit file changed on the VM (refreshed into state by Read) shows up
+// as a diff.
+func (r *VMServiceResource) ModifyPlan(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	if req.Plan.Raw.IsNull() {
+		return
+	}
+
+	var plan VMServiceResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() || plan.Content.IsUnknown() {
+		return
+	}
+
+	sum := types.StringNull()
+	if !plan.Content.IsNull() {
+		sum = types.StringValue(sha256Hex([]byte(plan.Content.ValueString())))
+	}
+	resp.Plan.SetAttribute(ctx, path.Root("content_sha256"), sum)
+}
+
+// apply writes the unit file if writeUnit is set, enables or disables the
+// unit, and starts (or restarts) or stops it. A unit that should be active
+// must reach the active state within the timeout; otherwise the journal
+// tail is reported. The computed state attributes are filled in at the end.
+func (r *VMServiceResource) apply(ctx context.Context, ssh *client.SSHClient, plan *VMServiceResourceModel, writeUnit, restart bool, diags *diag.Diagnostics) {
+	unit := plan.unit()
+	timeout, err := durationOrDefault(plan.Timeout, defaultServiceTimeout)
+	if err != nil {
+		diags.AddError("Invalid timeout", err.Error())
+		return
+	}
+
+	if writeUnit {
+		tflog.Debug(ctx, fmt.Sprintf("Writing unit file %s", plan.unitPath()))
+		if err := ssh.WriteStream(ctx, plan.unitPath(), strings.NewReader(plan.Content.ValueString()), client.FileAttrs{Mode: "0644"}); err != nil {
+			diags.AddError(fmt.Sprintf("Failed to write unit file for %s", unit), err.Error())
+			return
+		}
+		if err := runChecked(ctx, ssh, "systemctl daemon-reload", 2*time.Minute); err != nil {
+			diags.AddError("systemctl daemon-reload failed", err.Error())
+			return
+		}
+	}
+
+	action := "disable"
+	if plan.Enabled.ValueBool() {
+		action = "enable"
+	}
+	if err := runChecked(ctx, ssh, fmt.Sprintf("systemctl %s '%s'", action, client.ShellEscape(unit)), 2*time.Minute); err != nil {
+		diags.AddError(fmt.Sprintf("Failed to %s %s", action, unit), err.Error())
+		return
+	}
+
+	switch {
+	case !plan.Active.ValueBool():
+		action = "stop"
+	case restart:
+		action = "restart"
+	default:
+		action = "start"
+	}
+	tflog.Info(ctx, fmt.Sprintf("Running systemctl %s %s", action, unit))
+	// --no-block returns at once; waitActive below does the waiting, so a
+	// unit that hangs while starting cannot hang the apply.
+	if err := runChecked(ctx, ssh, fmt.Sprintf("systemctl %s --no-block '%s'", action, client.ShellEscape(unit)), 2*time.Minute); err != nil {
+		diags.AddError(fmt.Sprintf("Failed to %s %s", action, unit), err.Error())
+		return
+	}
+	if plan.Active.ValueBool() {
+		if err := waitActive(ctx, ssh, unit, timeout); err != nil {
+			diags.AddError(fmt.Sprintf("%s did not become active", unit),
+				fmt.Sprintf("%s\n\nLast journal entries:\n%s", err, journalTail(ctx, ssh, unit, 30)))
+			return
+		}
+	}
+
+	status, err := unitStatus(ctx, ssh, *plan)
+	if err != nil {
+		diags.AddError("Failed to read service status from VM", err.Error())
+		return
+	}
+	status.apply(plan)
+}
+
+// serviceStatus is what systemd reports about a unit.
+type serviceStatus struct {
+	LoadState     string
+	ActiveState   string
+	SubState      string
+	UnitFileState string
+	Type          string
+	Result        string
+	SHA256        string // of the unit file, "" if missing
+}
+
+// up reports whether the unit is where active = true wants it: active, or
+// for a Type=oneshot unit without RemainAfterExit, finished successfully,
+// since such a unit goes back to inactive once its command has run.
+func (s serviceStatus) up() bool {
+	return s.ActiveState == "active" ||
+		(s.Type == "oneshot" && s.ActiveState == "inactive" && s.Result == "success")
+}
+
+// apply copies the status into the computed attributes of m.
+func (s serviceStatus) apply(m *VMServiceResourceModel) {
+	m.ActiveState = types.StringValue(s.ActiveState)
+	m.SubState = types.StringValue(s.SubState)
+	m.UnitFileState = types.StringValue(s.UnitFileState)
+	if m.Content.IsNull() {
+		m.ContentSHA256 = types.StringNull()
+	} else {
+		m.ContentSHA256 = types.StringValue(s.SHA256)
+	}
+}
+
+// unitStatus reads the unit's state and the hash of its unit file in one
+// round trip.
+func unitStatus(ctx context.Context, ssh *client.SSHClient, m VMServiceResourceModel) (serviceStatus, error) {
+	f := client.ShellEscape(m.unitPath())
+	cmd := fmt.Sprintf("systemctl show '%s' -p LoadState -p ActiveState -p SubState -p UnitFileState -p Type -p Result --no-pager && "+
+		"if [ -f '%s' ]; then echo \"SHA256=$(sha256sum < '%s' | cut -d' ' -f1)\"; fi",
+		client.ShellEscape(m.unit()), f, f)
+	out, err := ssh.ExecWithTimeout(ctx, cmd, time.Minute)
+	if err != nil {
+		return serviceStatus{}, fmt.Errorf("query %s: %w", m.unit(), err)
+	}
+	return parseUnitStatus(out), nil
+}
+
+// parseUnitStatus parses the Key=Value lines printed by systemctl show.
+func parseUnitStatus(out string) serviceStatus {
+	var s serviceStatus
+	for _, line := range strings.Split(out, "\n") {
+		k, v, _ := strings.Cut(strings.TrimSpace(line), "=")
+		switch k {
+		case "LoadState":
+			s.LoadState = v
+		case "ActiveState":
+			s.ActiveState = v
+		case "SubState":
+			s.SubState = v
+		case "UnitFileState":
+			s.UnitFileState = v
+		case "Type":
+			s.Type = v
+		case "Result":
+			s.Result = v
+		case "SHA256":
+			s.SHA256 = v
+		}
+	}
+	return s
+}
+
+// waitActive polls until unit is up, fails or the timeout expires. The
+// unit must be seen up twice in a row, so one that crashes right after
+// starting is not mistaken for a healthy one.
+func waitActive(ctx context.Context, ssh *client.SSHClient, unit string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	state, seen := "", 0
+	for {
+		out, err := ssh.ExecWithTimeout(ctx, fmt.Sprintf("systemctl show '%s' -p ActiveState -p Type -p Result --no-pager", client.ShellEscape(unit)), time.Minute)
+		if err != nil {
+			return err
+		}
+		s := parseUnitStatus(out)
+		state = s.ActiveState
+		switch {
+		case s.up():
+			if seen++; seen == 2 {
+				return nil
+			}
+		case state == "failed":
+			return fmt.Errorf("%s failed to start", unit)
+		default:
+			seen = 0
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s still %q after %s", unit, state, timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// journalTail returns the last n journal lines of unit, or a note why they
+// could not be read.
+func journalTail(ctx context.Context, ssh *client.SSHClient, unit string, n int) string {
+	out, err := ssh.ExecWithTimeout(ctx, fmt.Sprintf("journalctl -u '%s' -n %d --no-pager 2>&1", client.ShellEscape(unit), n), 30*time.Second)
+	if err != nil {
+		return fmt.Sprintf("(could not read the journal: %s)", err)
+	}
+	return truncateTail(strings.TrimRight(out, "\n"), 4000)
+}
@@ -0,0 +1,26 @@
+package resources
+
+import "testing"
+
+func TestServiceStatusUp(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want bool
+	}{
+		{"active", "ActiveState=active\nType=simple\nResult=success\n", true},
+		{"inactive", "ActiveState=inactive\nType=simple\nResult=success\n", false},
+		{"failed", "ActiveState=failed\nType=simple\nResult=exit-code\n", false},
+		{"oneshot succeeded", "ActiveState=inactive\nType=oneshot\nResult=success\n", true},
+		{"oneshot running", "ActiveState=activating\nType=oneshot\nResult=success\n", false},
+		{"oneshot failed", "ActiveState=failed\nType=oneshot\nResult=exit-code\n", false},
+		{"oneshot remaining", "ActiveState=active\nType=oneshot\nResult=success\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseUnitStatus(tt.out).up(); got != tt.want {
+				t.Errorf("up() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
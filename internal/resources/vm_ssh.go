@@ -0,0 +1,106 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+
+	"github.com/hdresearch/vers-tf/internal/client"
+)
+
+// runCommand runs a single command with a timeout, returning its result.
+func runCommand(ctx context.Context, ssh *client.SSHClient, cmd string, stdin io.Reader, timeout time.Duration) (*client.ExecResult, error) {
+	tctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	res, err := ssh.Run(tctx, cmd, stdin)
+	if err != nil && ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+		return res, fmt.Errorf("command timed out after %s", timeout)
+	}
+	return res, err
+}
+
+// connectVM opens an SSH session to the VM and waits until it answers. It
+// returns nil after reporting the error in diags.
+func connectVM(ctx context.Context, c *client.Client, vmID string, diags *diag.Diagnostics) *client.SSHClient {
+	ssh, err := c.ConnectSSH(vmID)
+	if err != nil {
+		diags.AddError("Failed to connect to VM", err.Error())
+		return nil
+	}
+	if err := ssh.WaitReachable(ctx, 3*time.Minute); err != nil {
+		ssh.Cleanup()
+		diags.AddError("VM not reachable via SSH", err.Error())
+		return nil
+	}
+	return ssh
+}
+
+// runChecked runs cmd and turns a failure or non-zero exit code into an
+// error carrying the command's output.
+func runChecked(ctx context.Context, ssh *client.SSHClient, cmd string, timeout time.Duration) error {
+	res, err := runCommand(ctx, ssh, cmd, nil, timeout)
+	if err != nil || res.ExitCode != 0 {
+		return errors.New(commandFailureDetail(err, res, []int64{0}))
+	}
+	return nil
+}
+
+// allowedExitCodes returns the configured exit codes, defaulting to [0].
+func allowedExitCodes(ctx context.Context, l types.List) []int64 {
+	if l.IsNull() || l.IsUnknown() {
+		return []int64{0}
+	}
+	var codes []int64
+	l.ElementsAs(ctx, &codes, false)
+	return codes
+}
+
+func exitCodeAllowed(code int, allowed []int64) bool {
+	for _, c := range allowed {
+		if int64(code) == c {
+			return true
+		}
+	}
+	return false
+}
+
+// commandFailureDetail formats a diagnostic body with everything known
+// about a failed command.
+func commandFailureDetail(err error, res *client.ExecResult, allowed []int64) string {
+	var b strings.Builder
+	if err != nil {
+		fmt.Fprintf(&b, "Error: %s\n", err.Error())
+	}
+	if res != nil {
+		if err == nil {
+			fmt.Fprintf(&b, "Exit code: %d (allowed: %v)\n", res.ExitCode, allowed)
+		}
+		fmt.Fprintf(&b, "Duration: %s\n", res.Duration.Round(time.Millisecond))
+		fmt.Fprintf(&b, "Stderr: %s\n", truncateTail(res.Stderr, 2000))
+		fmt.Fprintf(&b, "Output: %s", truncateTail(res.Stdout, 2000))
+	}
+	return b.String()
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// truncateTail keeps the last n bytes of s, where errors usually are. The
+// result always is valid UTF-8, as Terraform requires of string values.
+func truncateTail(s string, n int) string {
+	if len(s) <= n {
+		return strings.ToValidUTF8(s, "")
+	}
+	return "..." + strings.ToValidUTF8(s[len(s)-n:], "")
+}
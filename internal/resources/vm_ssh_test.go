@@ -0,0 +1,22 @@
+package resources
+
+import "testing"
+
+func TestExitCodeAllowed(t *testing.T) {
+	tests := []struct {
+		code    int
+		allowed []int64
+		want    bool
+	}{
+		{0, []int64{0}, true},
+		{1, []int64{0}, false},
+		{1, []int64{0, 1}, true},
+		{0, []int64{2}, false},
+		{0, nil, false},
+	}
+	for _, tt := range tests {
+		if got := exitCodeAllowed(tt.code, tt.allowed); got != tt.want {
+			t.Errorf("exitCodeAllowed(%d, %v) = %v, want %v", tt.code, tt.allowed, got, tt.want)
+		}
+	}
+}
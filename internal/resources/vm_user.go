@@ -0,0 +1,611 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/boolplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+
+	"github.com/hdresearch/vers-tf/internal/client"
+)
+
+var (
+	_ resource.Resource                   = &VMUserResource{}
+	_ resource.ResourceWithConfigure      = &VMUserResource{}
+	_ resource.ResourceWithValidateConfig = &VMUserResource{}
+)
+
+// defaultUserShell is the login shell of accounts created without 'shell'.
+const defaultUserShell = "/bin/bash"
+
+// The authorized_keys lines this resource manages sit between these
+// markers. For an adopted account the lines outside them are the keys it
+// already had, which are kept on apply and destroy.
+const (
+	keysBlockBegin = "# BEGIN vers_vm_user"
+	keysBlockEnd   = "# END vers_vm_user"
+)
+
+var (
+	userNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+	// An authorized_keys line: optional options, then a key type and base64 blob.
+	authorizedKeyPattern = regexp.MustCompile(`(^|\s)(ssh-[a-z0-9-]+|ecdsa-sha2-[a-z0-9-]+|sk-[a-z0-9@.-]+)\s+[A-Za-z0-9+/]+=*(\s|$)`)
+)
+
+type VMUserResource struct {
+	client *client.Client
+}
+
+type VMUserResourceModel struct {
+	ID             types.String `tfsdk:"id"`
+	VMID           types.String `tfsdk:"vm_id"`
+	Name           types.String `tfsdk:"name"`
+	AuthorizedKeys types.List   `tfsdk:"authorized_keys"`
+	Sudo           types.Bool   `tfsdk:"sudo"`
+	Shell          types.String `tfsdk:"shell"`
+	Groups         types.List   `tfsdk:"groups"`
+	RemoveHome     types.Bool   `tfsdk:"remove_home"`
+	UID            types.Int64  `tfsdk:"uid"`
+	Home           types.String `tfsdk:"home"`
+	Adopted        types.Bool   `tfsdk:"adopted"`
+}
+
+func (m VMUserResourceModel) sudoersPath() string {
+	return "/etc/sudoers.d/vers-" + m.Name.ValueString()
+}
+
+func NewVMUserResource() resource.Resource {
+	return &VMUserResource{}
+}
+
+func (r *VMUserResource) Metadata(_ context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_vm_user"
+}
+
+func (r *VMUserResource) Schema(_ context.Context, _ resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Manage a Linux user on a Vers VM: its SSH authorized_keys, shell, groups and sudo rights. " +
+			"Gives people personal SSH access to a VM without sharing its root key. " +
+			"The account is read back on every refresh, so changes made on the VM show up as drift in the plan.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:    true,
+				Description: "Resource ID ({vm_id}:user:{name}).",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"vm_id": schema.StringAttribute{
+				Required:    true,
+				Description: "The VM ID to create the user on.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"name": schema.StringAttribute{
+				Required: true,
+				Description: "Login name. An existing account of that name is adopted: destroying the resource then only removes " +
+					"the keys and sudo rights it granted, never the account.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"authorized_keys": schema.ListAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "Public keys (authorized_keys lines) allowed to log in as the user. They replace the whole ~/.ssh/authorized_keys of an account " +
+					"this resource created; an adopted account keeps the keys it already had, and these are added in a marked block that destroy removes. " +
+					"Omit to leave the file alone.",
+			},
+			"sudo": schema.BoolAttribute{
+				Optional:    true,
+				Computed:    true,
+				Default:     booldefault.StaticBool(false),
+				Description: "Grant passwordless sudo via /etc/sudoers.d/vers-<name>. Default: false.",
+			},
+			"shell": schema.StringAttribute{
+				Optional: true,
+				Computed: true,
+				Description: "Login shell. Omit to give a new account \"" + defaultUserShell + "\" and to leave an adopted account's shell alone; " +
+					"the shell the account has is recorded either way.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"groups": schema.ListAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "Supplementary groups, which must already exist. They replace any others the user is in. Omit to leave the user's groups alone.",
+			},
+			"remove_home": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Remove the home directory when the user is destroyed. Default: false.",
+			},
+			"uid": schema.Int64Attribute{
+				Computed:    true,
+				Description: "Numeric user ID.",
+				PlanModifiers: []planmodifier.Int64{
+					int64planmodifier.UseStateForUnknown(),
+				},
+			},
+			"home": schema.StringAttribute{
+				Computed:    true,
+				Description: "Home directory.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+			"adopted": schema.BoolAttribute{
+				Computed:    true,
+				Description: "Whether the account already existed when the resource was created.",
+				PlanModifiers: []planmodifier.Bool{
+					boolplanmodifier.UseStateForUnknown(),
+				},
+			},
+		},
+	}
+}
+
+func (r *VMUserResource) Configure(_ context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+	c, ok := req.ProviderData.(*client.Client)
+	if !ok {
+		resp.Diagnostics.AddError("Unexpected Resource Configure Type", "Expected *client.Client")
+		return
+	}
+	r.client = c
+}
+
+func (r *VMUserResource) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var config VMUserResourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &config)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if known(config.Name) {
+		name := config.Name.ValueString()
+		switch {
+		case name == "root":
+			resp.Diagnostics.AddAttributeError(path.Root("name"), "Invalid user name",
+				"The root account cannot be managed by vers_vm_user.")
+		case !userNamePattern.MatchString(name):
+			resp.Diagnostics.AddAttributeError(path.Root("name"), "Invalid user name",
+				fmt.Sprintf("%q must start with a lowercase letter or '_' and contain only lowercase letters, digits, '_' and '-' (at most 32 characters).", name))
+		}
+	}
+
+	if known(config.Shell) && !strings.HasPrefix(config.Shell.ValueString(), "/") {
+		resp.Diagnostics.AddAttributeError(path.Root("shell"), "Invalid shell",
+			fmt.Sprintf("%q must be an absolute path.", config.Shell.ValueString()))
+	}
+
+	if !config.AuthorizedKeys.IsUnknown() {
+		for i, v := range config.AuthorizedKeys.Elements() {
+			s, ok := v.(types.String)
+			if !ok || !known(s) {
+				continue
+			}
+			key := strings.TrimSpace(s.ValueString())
+			if strings.ContainsAny(key, "\r\n") || !authorizedKeyPattern.MatchString(key) {
+				resp.Diagnostics.AddAttributeError(path.Root("authorized_keys").AtListIndex(i), "Invalid public key",
+					"Each entry must be a single authorized_keys line such as \"ssh-ed25519 AAAA... alice@laptop\".")
+			}
+		}
+	}
+
+	if !config.Groups.IsUnknown() {
+		for i, v := range config.Groups.Elements() {
+			s, ok := v.(types.String)
+			if ok && known(s) && !userNamePattern.MatchString(s.ValueString()) {
+				resp.Diagnostics.AddAttributeError(path.Root("groups").AtListIndex(i), "Invalid group name",
+					fmt.Sprintf("%q is not a valid group name.", s.ValueString()))
+			}
+		}
+	}
+}
+
+func (r *VMUserResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var plan VMUserResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	vmID := plan.VMID.ValueString()
+	tflog.Info(ctx, "Creating user on Vers VM", map[string]interface{}{"vm_id": vmID, "user": plan.Name.ValueString()})
+
+	ssh := connectVM(ctx, r.client, vmID, &resp.Diagnostics)
+	if ssh == nil {
+		return
+	}
+	defer ssh.Cleanup()
+
+	// An account that is already there (e.g. "ubuntu" or "postgres") is
+	// adopted, and must survive the resource being destroyed.
+	existing, err := readAccount(ctx, ssh, plan.Name.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to read user from VM", err.Error())
+		return
+	}
+	plan.Adopted = types.BoolValue(existing != nil)
+
+	r.apply(ctx, ssh, &plan, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	plan.ID = types.StringValue(fmt.Sprintf("%s:user:%s", vmID, plan.Name.ValueString()))
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *VMUserResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var state VMUserResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	vmID := state.VMID.ValueString()
+	vm, err := r.client.GetVM(vmID)
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to verify VM exists", err.Error())
+		return
+	}
+	if vm == nil {
+		// VM was deleted — the user went with it
+		resp.State.RemoveResource(ctx)
+		return
+	}
+	if vm.State != "running" {
+		// A paused VM can't be inspected; keep the last known state.
+		tflog.Debug(ctx, "VM not running, skipping user refresh", map[string]interface{}{"vm_id": vmID, "state": vm.State})
+		resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+		return
+	}
+
+	ssh, err := r.client.ConnectSSH(vmID)
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to connect to VM", err.Error())
+		return
+	}
+	defer ssh.Cleanup()
+
+	acct, err := readAccount(ctx, ssh, state.Name.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to read user from VM", err.Error())
+		return
+	}
+	if acct == nil {
+		// Deleted on the VM; plan to create it again.
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
+	// Record what the VM has, so the plan shows any difference from the
+	// configuration. Keys and groups are only tracked when configured.
+	acct.apply(&state)
+	state.Sudo = types.BoolValue(acct.Sudo)
+	if !state.AuthorizedKeys.IsNull() {
+		keys := acct.Keys
+		if state.Adopted.ValueBool() {
+			keys = acct.BlockKeys
+		}
+		if !sameStrings(stringList(ctx, state.AuthorizedKeys), keys, false) {
+			var diags diag.Diagnostics
+			state.AuthorizedKeys, diags = types.ListValueFrom(ctx, types.StringType, keys)
+			resp.Diagnostics.Append(diags...)
+		}
+	}
+	if !state.Groups.IsNull() {
+		// Group order carries no meaning; only report a different set.
+		if !sameStrings(stringList(ctx, state.Groups), acct.Groups, true) {
+			var diags diag.Diagnostics
+			state.Groups, diags = types.ListValueFrom(ctx, types.StringType, acct.Groups)
+			resp.Diagnostics.Append(diags...)
+		}
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
+}
+
+func (r *VMUserResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan, state VMUserResourceModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	tflog.Info(ctx, "Updating user on Vers VM", map[string]interface{}{"vm_id": plan.VMID.ValueString(), "user": plan.Name.ValueString()})
+
+	ssh := connectVM(ctx, r.client, plan.VMID.ValueString(), &resp.Diagnostics)
+	if ssh == nil {
+		return
+	}
+	defer ssh.Cleanup()
+
+	r.apply(ctx, ssh, &plan, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	plan.ID = state.ID
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *VMUserResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var state VMUserResourceModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	vmID := state.VMID.ValueString()
+	vm, err := r.client.GetVM(vmID)
+	if err != nil {
+		resp.Diagnostics.AddError("Failed to verify VM exists", err.Error())
+		return
+	}
+	if vm == nil {
+		tflog.Debug(ctx, "VM already deleted, nothing to remove", map[string]interface{}{"vm_id": vmID})
+		return
+	}
+
+	ssh := connectVM(ctx, r.client, vmID, &resp.Diagnostics)
+	if ssh == nil {
+		return
+	}
+	defer ssh.Cleanup()
+
+	name := state.Name.ValueString()
+	if state.Adopted.ValueBool() {
+		// Only take back what this resource granted: its sudoers file and
+		// its block of keys.
+		cmd := fmt.Sprintf("rm -f '%s'", client.ShellEscape(state.sudoersPath()))
+		if state.Home.ValueString() != "" {
+			cmd += fmt.Sprintf("; f='%s/.ssh/authorized_keys'; [ ! -f \"$f\" ] || sed -i '%s' \"$f\"",
+				client.ShellEscape(state.Home.ValueString()), keysBlockSed)
+		}
+		tflog.Debug(ctx, "Removing access granted to adopted user", map[string]interface{}{"vm_id": vmID, "user": name})
+		if err := runChecked(ctx, ssh, cmd, time.Minute); err != nil {
+			resp.Diagnostics.AddError(fmt.Sprintf("Failed to remove access for %s", name), err.Error())
+		}
+		return
+	}
+
+	userdel := "userdel"
+	if state.RemoveHome.ValueBool() {
+		userdel += " -r"
+	}
+	// The user's processes would make userdel fail; end them first. userdel
+	// also exits non-zero for harmless warnings (e.g. no mail spool), so
+	// success is judged by whether the account is gone.
+	cmd := fmt.Sprintf("rm -f '%s'; if id -u '%s' >/dev/null 2>&1; then pkill -KILL -u '%s'; sleep 1; %s '%s'; fi; ! id -u '%s' >/dev/null 2>&1",
+		client.ShellEscape(state.sudoersPath()), name, name, userdel, name, name)
+	tflog.Debug(ctx, "Removing user from Vers VM", map[string]interface{}{"vm_id": vmID, "user": name})
+	if err := runChecked(ctx, ssh, cmd, 2*time.Minute); err != nil {
+		resp.Diagnostics.AddError(fmt.Sprintf("Failed to remove user %s", name), err.Error())
+	}
+}
+
+// apply creates the user or brings an existing one in line with plan, then
+// fills in the computed attributes.
+func (r *VMUserResource) apply(ctx context.Context, ssh *client.SSHClient, plan *VMUserResourceModel, diags *diag.Diagnostics) {
+	name := plan.Name.ValueString()
+
+	// Without a configured shell (unknown only on create) an existing
+	// account keeps its own, e.g. /usr/sbin/nologin for a service account.
+	shellArg, newShell := "", defaultUserShell
+	if known(plan.Shell) {
+		shellArg = fmt.Sprintf(" -s '%s'", client.ShellEscape(plan.Shell.ValueString()))
+		newShell = plan.Shell.ValueString()
+	}
+	groupArgs := ""
+	if !plan.Groups.IsNull() {
+		groupArgs = fmt.Sprintf(" -G '%s'", strings.Join(stringList(ctx, plan.Groups), ","))
+	}
+	// usermod refuses to run without options.
+	modify := "true"
+	if shellArg+groupArgs != "" {
+		modify = fmt.Sprintf("usermod%s%s '%s'", shellArg, groupArgs, name)
+	}
+	// '*' instead of useradd's locked '!' password: no password login, but
+	// sshd still accepts keys when it runs without PAM.
+	cmd := fmt.Sprintf("if id -u '%s' >/dev/null 2>&1; then %s; else useradd -m -p '*' -s '%s'%s '%s'; fi",
+		name, modify, client.ShellEscape(newShell), groupArgs, name)
+	if err := runChecked(ctx, ssh, cmd, 2*time.Minute); err != nil {
+		diags.AddError(fmt.Sprintf("Failed to create or update user %s", name), err.Error())
+		return
+	}
+
+	acct, err := readAccount(ctx, ssh, name)
+	if err == nil && acct == nil {
+		err = fmt.Errorf("user %s does not exist after useradd", name)
+	}
+	if err != nil {
+		diags.AddError("Failed to read user from VM", err.Error())
+		return
+	}
+
+	if !plan.AuthorizedKeys.IsNull() {
+		if err := writeAuthorizedKeys(ctx, ssh, name, acct, stringList(ctx, plan.AuthorizedKeys), plan.Adopted.ValueBool()); err != nil {
+			diags.AddError(fmt.Sprintf("Failed to write authorized_keys for %s", name), err.Error())
+			return
+		}
+	}
+
+	sudoers := client.ShellEscape(plan.sudoersPath())
+	cmd = fmt.Sprintf("rm -f '%s'", sudoers)
+	if plan.Sudo.ValueBool() {
+		// Validate before installing: a broken sudoers file locks out sudo
+		// for everyone.
+		cmd = fmt.Sprintf("set -e; tmp=$(mktemp); trap 'rm -f \"$tmp\"' EXIT; "+
+			"echo '%s ALL=(ALL) NOPASSWD:ALL' > \"$tmp\"; visudo -cqf \"$tmp\"; install -m 0440 \"$tmp\" '%s'",
+			name, sudoers)
+	}
+	if err := runChecked(ctx, ssh, cmd, time.Minute); err != nil {
+		diags.AddError(fmt.Sprintf("Failed to configure sudo for %s", name), err.Error())
+		return
+	}
+
+	acct.apply(plan)
+}
+
+// keysBlockSed is a sed script that deletes the managed block of keys.
+var keysBlockSed = fmt.Sprintf("/^%s$/,/^%s$/d", keysBlockBegin, keysBlockEnd)
+
+// writeAuthorizedKeys installs keys as the managed block of the user's
+// authorized_keys. With keep, the lines outside the block are kept;
+// otherwise the block replaces the whole file.
+func writeAuthorizedKeys(ctx context.Context, ssh *client.SSHClient, name string, acct *account, keys []string, keep bool) error {
+	var block strings.Builder
+	block.WriteString(keysBlockBegin + "\n")
+	for _, k := range keys {
+		block.WriteString(strings.TrimSpace(k) + "\n")
+	}
+	block.WriteString(keysBlockEnd + "\n")
+
+	others := ""
+	if keep {
+		others = fmt.Sprintf("{ [ ! -f \"$f\" ] || sed '%s' \"$f\"; } && ", keysBlockSed)
+	}
+	group := client.ShellEscape(acct.Group)
+	cmd := fmt.Sprintf("d='%s/.ssh'; f=\"$d/authorized_keys\"; install -d -m 0700 -o '%s' -g '%s' \"$d\" && tmp=$(mktemp) && "+
+		"{ { %scat; } > \"$tmp\" && install -m 0600 -o '%s' -g '%s' \"$tmp\" \"$f\"; rc=$?; rm -f \"$tmp\"; exit $rc; }",
+		client.ShellEscape(acct.Home), name, group, others, name, group)
+	res, err := runCommand(ctx, ssh, cmd, strings.NewReader(block.String()), time.Minute)
+	if err != nil || res.ExitCode != 0 {
+		return errors.New(commandFailureDetail(err, res, []int64{0}))
+	}
+	return nil
+}
+
+// account is a user as found on the VM.
+type account struct {
+	UID    int64
+	Home   string
+	Shell  string
+	Group  string   // primary group
+	Groups []string // supplementary groups, sorted
+	Sudo   bool
+	Keys   []string // authorized_keys lines, in file order
+
+	// BlockKeys are the Keys between keysBlockBegin and keysBlockEnd.
+	BlockKeys []string
+}
+
+// apply copies the account into the computed attributes of m.
+func (a account) apply(m *VMUserResourceModel) {
+	m.UID = types.Int64Value(a.UID)
+	m.Home = types.StringValue(a.Home)
+	m.Shell = types.StringValue(a.Shell)
+}
+
+// readAccount reads the passwd entry, groups, sudoers file and authorized
+// keys of a user in one round trip. It returns nil if the user does not exist.
+func readAccount(ctx context.Context, ssh *client.SSHClient, name string) (*account, error) {
+	cmd := fmt.Sprintf("p=$(getent passwd '%s') || exit 0; echo \"$p\"; "+
+		"echo '--group'; id -gn '%s'; echo '--groups'; id -nG '%s'; "+
+		"echo '--sudo'; [ -f '%s' ] && echo yes; "+
+		"echo '--keys'; cat \"$(echo \"$p\" | cut -d: -f6)/.ssh/authorized_keys\" 2>/dev/null; true",
+		name, name, name, client.ShellEscape(VMUserResourceModel{Name: types.StringValue(name)}.sudoersPath()))
+	out, err := ssh.ExecWithTimeout(ctx, cmd, time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("query user %s: %w", name, err)
+	}
+	return parseAccount(name, out)
+}
+
+// parseAccount parses the output of the query in readAccount.
+func parseAccount(name, out string) (*account, error) {
+	if strings.TrimSpace(out) == "" {
+		return nil, nil
+	}
+
+	lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+	fields := strings.Split(lines[0], ":")
+	if len(fields) != 7 {
+		return nil, fmt.Errorf("query user %s: unexpected passwd entry %q", name, lines[0])
+	}
+	uid, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("query user %s: bad uid %q", name, fields[2])
+	}
+	a := &account{UID: uid, Home: fields[5], Shell: fields[6], Groups: []string{}, Keys: []string{}, BlockKeys: []string{}}
+
+	section, inBlock := "", false
+	for _, line := range lines[1:] {
+		if strings.HasPrefix(line, "--") {
+			section = line
+			continue
+		}
+		switch section {
+		case "--group":
+			a.Group = strings.TrimSpace(line)
+		case "--groups":
+			for _, g := range strings.Fields(line) {
+				if g != a.Group {
+					a.Groups = append(a.Groups, g)
+				}
+			}
+		case "--sudo":
+			a.Sudo = strings.TrimSpace(line) == "yes"
+		case "--keys":
+			switch k := strings.TrimSpace(line); {
+			case k == keysBlockBegin:
+				inBlock = true
+			case k == keysBlockEnd:
+				inBlock = false
+			case k != "" && !strings.HasPrefix(k, "#"):
+				a.Keys = append(a.Keys, k)
+				if inBlock {
+					a.BlockKeys = append(a.BlockKeys, k)
+				}
+			}
+		}
+	}
+	sort.Strings(a.Groups)
+	return a, nil
+}
+
+// sameStrings reports whether a and b hold the same strings, ignoring
+// surrounding whitespace, and ignoring order if unordered is set.
+func sameStrings(a, b []string, unordered bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	x := make([]string, len(a))
+	y := make([]string, len(b))
+	for i := range a {
+		x[i], y[i] = strings.TrimSpace(a[i]), strings.TrimSpace(b[i])
+	}
+	if unordered {
+		sort.Strings(x)
+		sort.Strings(y)
+	}
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package resources
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSameStrings(t *testing.T) {
+	tests := []struct {
+		a, b      []string
+		unordered bool
+		want      bool
+	}{
+		{nil, []string{}, false, true},
+		{[]string{"a", "b"}, []string{"a", "b"}, false, true},
+		{[]string{"a", "b"}, []string{"b", "a"}, false, false},
+		{[]string{"a", "b"}, []string{"b", "a"}, true, true},
+		{[]string{" ssh-ed25519 AAAA\n"}, []string{"ssh-ed25519 AAAA"}, false, true},
+		{[]string{"a"}, []string{"a", "a"}, true, false},
+		{[]string{"a", "a"}, []string{"a", "b"}, true, false},
+	}
+	for _, tt := range tests {
+		if got := sameStrings(tt.a, tt.b, tt.unordered); got != tt.want {
+			t.Errorf("sameStrings(%q, %q, %v) = %v, want %v", tt.a, tt.b, tt.unordered, got, tt.want)
+		}
+	}
+}
+
+func TestParseAccount(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		want    *account
+		wantErr bool
+	}{
+		{name: "missing user", out: "\n", want: nil},
+		{
+			name: "full",
+			out: "alice:x:1001:1001::/home/alice:/bin/bash\n" +
+				"--group\nalice\n" +
+				"--groups\nalice wheel docker\n" +
+				"--sudo\nyes\n" +
+				"--keys\n# managed by terraform\nssh-ed25519 AAAA alice@laptop\n\nssh-rsa BBBB alice@desk\n",
+			want: &account{
+				UID: 1001, Home: "/home/alice", Shell: "/bin/bash", Group: "alice",
+				Groups: []string{"docker", "wheel"}, Sudo: true,
+				Keys: []string{"ssh-ed25519 AAAA alice@laptop", "ssh-rsa BBBB alice@desk"}, BlockKeys: []string{},
+			},
+		},
+		{
+			name: "no sudo or keys",
+			out:  "bob:x:1002:100::/srv/bob:/bin/sh\n--group\nusers\n--groups\nusers\n--sudo\n--keys\n",
+			want: &account{UID: 1002, Home: "/srv/bob", Shell: "/bin/sh", Group: "users", Groups: []string{}, Keys: []string{}, BlockKeys: []string{}},
+		},
+		{
+			name: "managed block",
+			out: "ubuntu:x:1000:1000::/home/ubuntu:/bin/bash\n--group\nubuntu\n--groups\nubuntu\n--sudo\n" +
+				"--keys\nssh-ed25519 CCCC ops@bastion\n" + keysBlockBegin + "\nssh-ed25519 AAAA alice@laptop\n" + keysBlockEnd + "\n",
+			want: &account{
+				UID: 1000, Home: "/home/ubuntu", Shell: "/bin/bash", Group: "ubuntu", Groups: []string{},
+				Keys:      []string{"ssh-ed25519 CCCC ops@bastion", "ssh-ed25519 AAAA alice@laptop"},
+				BlockKeys: []string{"ssh-ed25519 AAAA alice@laptop"},
+			},
+		},
+		{name: "short passwd entry", out: "carol:x:1003\n", wantErr: true},
+		{name: "bad uid", out: "dave:x:abc:1004::/home/dave:/bin/bash\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAccount("user", tt.out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}